@@ -0,0 +1,180 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// defaultAppendBatch is the amount of data buffered by Appender before it is flushed
+const defaultAppendBatch = 64 * 1024
+
+// Append appends data from @input to the end of the record.
+func (s *Session) Append(key string, input io.Reader) <-chan Lookuper {
+	return s.AppendCtx(context.Background(), key, input)
+}
+
+// AppendCtx is an Append which is stopped when @ctx is done.
+func (s *Session) AppendCtx(ctx context.Context, key string, input io.Reader, options ...CallOption) <-chan Lookuper {
+	ekey, err := NewKey(key)
+	if err != nil {
+		responseCh := make(chan Lookuper, 1)
+		responseCh <- &lookupResult{err: err}
+		close(responseCh)
+		return responseCh
+	}
+	defer ekey.Free()
+
+	return s.WriteKeyCtx(ctx, ekey, input, 0, 0, withOptions(options, WithIOflags(DNET_IO_FLAGS_APPEND))...)
+}
+
+// Appender is an io.WriteCloser which batches small writes into append operations.
+// It is not safe for concurrent use.
+type Appender struct {
+	session *Session
+	ctx     context.Context
+	key     string
+	batch   int
+
+	buf  bytes.Buffer
+	size uint64
+
+	// outcome of the last flush in every group
+	results []GroupResult
+
+	// the first flush error, all writes fail after it
+	err error
+}
+
+// NewAppender returns appender to the record @key which flushes data when @batch bytes have been buffered,
+// zero @batch means defaultAppendBatch. Appends are bound to @ctx.
+func NewAppender(ctx context.Context, session *Session, key string, batch int) (*Appender, error) {
+	// negative replies are needed to report failed groups
+	s, err := CloneSession(session)
+	if err != nil {
+		return nil, err
+	}
+	s.SetFilter(SessionFilterAll)
+
+	if batch <= 0 {
+		batch = defaultAppendBatch
+	}
+
+	return &Appender{
+		session: s,
+		ctx:     ctx,
+		key:     key,
+		batch:   batch,
+	}, nil
+}
+
+// Write buffers @p and flushes the buffer when it reaches the batch size.
+func (a *Appender) Write(p []byte) (int, error) {
+	if a.err != nil {
+		return 0, a.err
+	}
+
+	n, _ := a.buf.Write(p)
+	if a.buf.Len() >= a.batch {
+		if _, err := a.Flush(); err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// Flush appends buffered data to the record and returns the record size reported by the servers.
+// Flush fails unless every group has accepted the data. If only some groups have accepted it,
+// replicas differ: the error is a MultiError with failures of other groups, Results() tells
+// which groups have the data and all further writes fail.
+func (a *Appender) Flush() (uint64, error) {
+	if a.err != nil {
+		return a.size, a.err
+	}
+
+	if a.buf.Len() == 0 {
+		return a.size, nil
+	}
+
+	results, errs, good := collectWrites(a.session.AppendCtx(a.ctx, a.key, bytes.NewReader(a.buf.Bytes())))
+	a.results = results
+
+	replied := make(map[uint32]bool, len(results))
+	for _, res := range results {
+		replied[res.Group] = true
+	}
+	for _, group := range a.session.GetGroups() {
+		if !replied[group] {
+			errs.add(group, nil, 0, &DnetError{
+				Code:    ErrTimeout.Code,
+				Flags:   0,
+				Message: fmt.Sprintf("no reply from group %d", group),
+			})
+		}
+	}
+
+	if good == 0 {
+		a.err = errs.failure()
+		return a.size, a.err
+	}
+
+	// data has been appended at least somewhere, it must not be sent again
+	a.buf.Reset()
+	for _, res := range results {
+		if res.Err == nil && res.Info.Size > a.size {
+			a.size = res.Info.Size
+		}
+	}
+
+	if len(errs.Errors) != 0 {
+		a.err = errs
+		return a.size, a.err
+	}
+
+	return a.size, nil
+}
+
+// Results returns outcome of the last flush in every group.
+func (a *Appender) Results() []GroupResult {
+	return a.results
+}
+
+// Size returns the record size reported by the last successful flush.
+func (a *Appender) Size() uint64 {
+	return a.size
+}
+
+// Close flushes buffered data and releases the appender.
+func (a *Appender) Close() error {
+	if a.session == nil {
+		return a.err
+	}
+
+	_, err := a.Flush()
+
+	a.session.Delete()
+	a.session = nil
+
+	if err == nil {
+		// no writes after close
+		a.err = io.ErrClosedPipe
+	}
+	return err
+}
@@ -0,0 +1,300 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerFailures    = 5
+	defaultBreakerOpenTimeout = 10 * time.Second
+)
+
+// BreakerState is the state of one circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed: requests go through, failures are counted
+	BreakerClosed BreakerState = iota
+	// BreakerOpen: requests are not sent until open timeout expires
+	BreakerOpen
+	// BreakerHalfOpen: one probe request is let through, its outcome closes or opens the breaker again
+	BreakerHalfOpen
+)
+
+var BreakerStateString = map[BreakerState]string{
+	BreakerClosed:   "closed",
+	BreakerOpen:     "open",
+	BreakerHalfOpen: "half-open",
+}
+
+func (s BreakerState) String() string {
+	return BreakerStateString[s]
+}
+
+// BreakerConfig controls CircuitBreaker, zero values mean defaults.
+type BreakerConfig struct {
+	// Failures is the number of consecutive failures which trips the breaker
+	Failures int
+
+	// OpenTimeout is the time breaker stays open before a probe request is let through
+	OpenTimeout time.Duration
+
+	// Codes are error codes counted as failures, DefaultRetryableCodes are used if it is empty.
+	// Other replies, including errors like -ENOENT, prove that the backend is alive.
+	Codes []int
+}
+
+type breaker struct {
+	state    BreakerState
+	failures int
+	changed  time.Time
+}
+
+// BreakerInfo is the state of one circuit breaker.
+type BreakerInfo struct {
+	State BreakerState
+
+	// consecutive failures seen in closed state
+	Failures int
+
+	// time of the last state change
+	Changed time.Time
+}
+
+/*
+CircuitBreaker tracks failures of groups and backends (AddressBackend) observed by sessions it is set on.
+
+Groups whose breaker is open are dropped from the groups of the request, after OpenTimeout
+one request is sent to such group as a probe: success closes the breaker, failure opens it again.
+If breakers of all groups of the request are open, the request is sent to all of them.
+
+Backend breakers are not used for routing, since the backend which serves the key is chosen by elliptics,
+their state is available through Backends() for monitoring and group selection.
+
+CircuitBreaker is safe for concurrent use and can be shared by many sessions.
+*/
+type CircuitBreaker struct {
+	mutex    sync.Mutex
+	config   BreakerConfig
+	groups   map[uint32]*breaker
+	backends map[AddressBackend]*breaker
+}
+
+// NewCircuitBreaker returns breaker with all groups and backends closed.
+func NewCircuitBreaker(config BreakerConfig) *CircuitBreaker {
+	if config.Failures <= 0 {
+		config.Failures = defaultBreakerFailures
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = defaultBreakerOpenTimeout
+	}
+	if len(config.Codes) == 0 {
+		config.Codes = DefaultRetryableCodes
+	}
+
+	return &CircuitBreaker{
+		config:   config,
+		groups:   make(map[uint32]*breaker),
+		backends: make(map[AddressBackend]*breaker),
+	}
+}
+
+func (cb *CircuitBreaker) failure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	ke := DnetErrorFromError(err)
+	if ke == nil {
+		return false
+	}
+
+	for _, code := range cb.config.Codes {
+		if ke.Code == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cb *CircuitBreaker) update(b *breaker, failed bool, now time.Time) {
+	if !failed {
+		if b.state != BreakerClosed {
+			b.changed = now
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	switch b.state {
+	case BreakerClosed:
+		b.failures++
+		if b.failures >= cb.config.Failures {
+			b.state = BreakerOpen
+			b.changed = now
+		}
+	case BreakerHalfOpen:
+		// probe has failed
+		b.state = BreakerOpen
+		b.changed = now
+	}
+}
+
+// Observe records outcome of the request to @group served by @addr/@backend, @addr may be nil.
+func (cb *CircuitBreaker) Observe(group uint32, addr *DnetAddr, backend int32, err error) {
+	failed := cb.failure(err)
+	now := time.Now()
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if group != 0 {
+		b, ok := cb.groups[group]
+		if !ok {
+			b = &breaker{changed: now}
+			cb.groups[group] = b
+		}
+		cb.update(b, failed, now)
+	}
+
+	if addr != nil && len(addr.Addr) != 0 {
+		ab := NewAddressBackend(addr, backend)
+		b, ok := cb.backends[ab]
+		if !ok {
+			b = &breaker{changed: now}
+			cb.backends[ab] = b
+		}
+		cb.update(b, failed, now)
+	}
+}
+
+// Allow returns @groups without those whose breakers are open, it switches breakers
+// whose open timeout has expired into half-open state and lets a probe through them.
+func (cb *CircuitBreaker) Allow(groups []uint32) []uint32 {
+	now := time.Now()
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	allowed := make([]uint32, 0, len(groups))
+	for _, group := range groups {
+		b, ok := cb.groups[group]
+		if !ok {
+			allowed = append(allowed, group)
+			continue
+		}
+
+		switch b.state {
+		case BreakerClosed:
+			allowed = append(allowed, group)
+		case BreakerOpen, BreakerHalfOpen:
+			// half-open breaker whose probe has not completed in time lets another probe through
+			if now.Sub(b.changed) >= cb.config.OpenTimeout {
+				b.state = BreakerHalfOpen
+				b.changed = now
+				allowed = append(allowed, group)
+			}
+		}
+	}
+
+	if len(allowed) == 0 {
+		return groups
+	}
+
+	return allowed
+}
+
+func (b *breaker) info() BreakerInfo {
+	return BreakerInfo{
+		State:    b.state,
+		Failures: b.failures,
+		Changed:  b.changed,
+	}
+}
+
+// Group returns state of the group breaker.
+func (cb *CircuitBreaker) Group(group uint32) BreakerInfo {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if b, ok := cb.groups[group]; ok {
+		return b.info()
+	}
+
+	return BreakerInfo{}
+}
+
+// Backend returns state of the backend breaker.
+func (cb *CircuitBreaker) Backend(ab AddressBackend) BreakerInfo {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if b, ok := cb.backends[ab]; ok {
+		return b.info()
+	}
+
+	return BreakerInfo{}
+}
+
+// Groups returns states of all group breakers seen so far.
+func (cb *CircuitBreaker) Groups() map[uint32]BreakerInfo {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	ret := make(map[uint32]BreakerInfo, len(cb.groups))
+	for group, b := range cb.groups {
+		ret[group] = b.info()
+	}
+
+	return ret
+}
+
+// Backends returns states of all backend breakers seen so far.
+func (cb *CircuitBreaker) Backends() map[AddressBackend]BreakerInfo {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	ret := make(map[AddressBackend]BreakerInfo, len(cb.backends))
+	for ab, b := range cb.backends {
+		ret[ab] = b.info()
+	}
+
+	return ret
+}
+
+// Reset closes all breakers.
+func (cb *CircuitBreaker) Reset() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.groups = make(map[uint32]*breaker)
+	cb.backends = make(map[AddressBackend]*breaker)
+}
+
+// SetCircuitBreaker sets breaker which observes results of the session requests and drops failing groups from them,
+// nil disables it. Cloned sessions share the breaker.
+func (s *Session) SetCircuitBreaker(cb *CircuitBreaker) {
+	s.breaker = cb
+}
+
+func (s *Session) GetCircuitBreaker() *CircuitBreaker {
+	return s.breaker
+}
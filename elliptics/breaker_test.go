@@ -0,0 +1,50 @@
+package elliptics
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func init() {
+	Suite(&BreakerSuite{})
+}
+
+type BreakerSuite struct{}
+
+func (s *BreakerSuite) TestCircuitBreaker(c *C) {
+	cb := NewCircuitBreaker(BreakerConfig{
+		Failures:    2,
+		OpenTimeout: 50 * time.Millisecond,
+	})
+	timeout := &DnetError{Code: -110, Message: "timed out"}
+	noent := &DnetError{Code: -2, Message: "no such file"}
+	groups := []uint32{1, 2, 3}
+
+	cb.Observe(2, nil, 0, timeout)
+	cb.Observe(2, nil, 0, noent)
+	cb.Observe(2, nil, 0, timeout)
+	c.Assert(cb.Group(2).State, Equals, BreakerClosed)
+
+	cb.Observe(2, nil, 0, timeout)
+	c.Assert(cb.Group(2).State, Equals, BreakerOpen)
+	c.Assert(cb.Allow(groups), DeepEquals, []uint32{1, 3})
+
+	time.Sleep(60 * time.Millisecond)
+	c.Assert(cb.Allow(groups), DeepEquals, groups)
+	c.Assert(cb.Group(2).State, Equals, BreakerHalfOpen)
+	c.Assert(cb.Allow(groups), DeepEquals, []uint32{1, 3})
+
+	cb.Observe(2, nil, 0, timeout)
+	c.Assert(cb.Group(2).State, Equals, BreakerOpen)
+
+	time.Sleep(60 * time.Millisecond)
+	cb.Allow(groups)
+	cb.Observe(2, nil, 0, nil)
+	c.Assert(cb.Group(2).State, Equals, BreakerClosed)
+	c.Assert(cb.Allow(groups), DeepEquals, groups)
+
+	cb.Observe(1, nil, 0, timeout)
+	cb.Observe(1, nil, 0, timeout)
+	c.Assert(cb.Allow([]uint32{1}), DeepEquals, []uint32{1})
+}
@@ -0,0 +1,224 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"bytes"
+	"context"
+	"sync"
+)
+
+// defaultBulkInFlight is the number of concurrent writes used by BulkWrite by default
+const defaultBulkInFlight = 64
+
+// BulkWriteOptions bounds resources used by BulkWrite.
+type BulkWriteOptions struct {
+	// InFlight is the maximum number of concurrent writes, zero means defaultBulkInFlight
+	InFlight int
+
+	// MaxBytes is the maximum total size of data of concurrent writes, zero means no limit.
+	// Object larger than MaxBytes is written when there are no other writes in flight.
+	MaxBytes uint64
+}
+
+// BulkItem is one object written by BulkWriteStream.
+type BulkItem struct {
+	Key  string
+	Data []byte
+}
+
+// BulkWriteResult is an outcome of writing one key.
+type BulkWriteResult struct {
+	Key string
+
+	// Groups contains outcome of the write in every group
+	Groups []GroupResult
+
+	// Err is set when no group has accepted the data
+	Err error
+}
+
+// bulkLimiter limits the number and total size of writes in flight.
+type bulkLimiter struct {
+	mutex sync.Mutex
+	cond  *sync.Cond
+
+	inFlight, maxInFlight int
+	bytes, maxBytes       uint64
+}
+
+func newBulkLimiter(opts *BulkWriteOptions) *bulkLimiter {
+	l := &bulkLimiter{
+		maxInFlight: opts.InFlight,
+		maxBytes:    opts.MaxBytes,
+	}
+	if l.maxInFlight <= 0 {
+		l.maxInFlight = defaultBulkInFlight
+	}
+	l.cond = sync.NewCond(&l.mutex)
+
+	return l
+}
+
+func (l *bulkLimiter) fits(size uint64) bool {
+	if l.inFlight == 0 {
+		return true
+	}
+
+	return l.inFlight < l.maxInFlight &&
+		(l.maxBytes == 0 || l.bytes+size <= l.maxBytes)
+}
+
+// Acquire waits until write of @size bytes fits into limits, it returns false if @ctx is done.
+func (l *bulkLimiter) Acquire(ctx context.Context, size uint64) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for !l.fits(size) {
+		if ctx.Err() != nil {
+			return false
+		}
+		l.cond.Wait()
+	}
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	l.inFlight++
+	l.bytes += size
+	return true
+}
+
+func (l *bulkLimiter) Release(size uint64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.inFlight--
+	l.bytes -= size
+	l.cond.Broadcast()
+}
+
+// Wake wakes up all waiters, so that they can notice cancelled context.
+func (l *bulkLimiter) Wake() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.cond.Broadcast()
+}
+
+// BulkWrite writes all objects from @data concurrently within limits set by @opts.
+// Result channel gets one result for every key.
+func (s *Session) BulkWrite(data map[string][]byte, opts BulkWriteOptions) <-chan BulkWriteResult {
+	return s.BulkWriteCtx(context.Background(), data, opts)
+}
+
+// BulkWriteCtx is a BulkWrite which is stopped when @ctx is done, keys which have not been sent
+// by that time get the context error.
+func (s *Session) BulkWriteCtx(ctx context.Context, data map[string][]byte, opts BulkWriteOptions,
+	options ...CallOption) <-chan BulkWriteResult {
+	items := make(chan BulkItem)
+	go func() {
+		defer close(items)
+
+		for key, d := range data {
+			items <- BulkItem{
+				Key:  key,
+				Data: d,
+			}
+		}
+	}()
+
+	return s.BulkWriteStream(ctx, items, opts, options...)
+}
+
+// BulkWriteStream writes objects received from @items until it is closed, concurrently within limits set by @opts.
+// Result channel gets one result for every received item and it is closed after all writes have completed.
+// When @ctx is done, items are drained from @items and get the context error.
+func (s *Session) BulkWriteStream(ctx context.Context, items <-chan BulkItem, opts BulkWriteOptions,
+	options ...CallOption) <-chan BulkWriteResult {
+	responseCh := make(chan BulkWriteResult, defaultVOLUME)
+
+	// negative replies are needed to report failed groups
+	session, err := CloneSession(s)
+	if err != nil {
+		go func() {
+			for item := range items {
+				responseCh <- BulkWriteResult{
+					Key: item.Key,
+					Err: err,
+				}
+			}
+			close(responseCh)
+		}()
+		return responseCh
+	}
+	session.SetFilter(SessionFilterAll)
+
+	limiter := newBulkLimiter(&opts)
+	stopWake := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			limiter.Wake()
+		case <-stopWake:
+		}
+	}()
+
+	var wg sync.WaitGroup
+
+	write := func(item BulkItem, size uint64) {
+		defer wg.Done()
+		defer limiter.Release(size)
+
+		res := BulkWriteResult{
+			Key: item.Key,
+		}
+
+		results, errs, good := collectWrites(session.WriteDataCtx(ctx, item.Key,
+			bytes.NewReader(item.Data), 0, size, options...))
+		res.Groups = results
+		if good == 0 {
+			res.Err = errs.failure()
+		}
+
+		responseCh <- res
+	}
+
+	go func() {
+		for item := range items {
+			size := uint64(len(item.Data))
+
+			if !limiter.Acquire(ctx, size) {
+				responseCh <- BulkWriteResult{
+					Key: item.Key,
+					Err: ctx.Err(),
+				}
+				continue
+			}
+
+			wg.Add(1)
+			go write(item, size)
+		}
+
+		wg.Wait()
+		close(stopWake)
+		session.Delete()
+		close(responseCh)
+	}()
+
+	return responseCh
+}
@@ -0,0 +1,81 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+/*
+   Cache layer
+
+   Records written into cache with a lifetime are removed from it when the lifetime expires.
+   To write data both into cache and on disk pass WithIOflags(DNET_IO_FLAGS_CACHE),
+   adding DNET_IO_FLAGS_CACHE_REMOVE_FROM_DISK also removes the record from disk when it expires in cache.
+*/
+
+// cacheOnly returns @options extended with cache-only IO flags.
+func cacheOnly(options []CallOption) []CallOption {
+	return withOptions(options, WithIOflags(DNET_IO_FLAGS_CACHE|DNET_IO_FLAGS_CACHE_ONLY))
+}
+
+// WriteCache writes data from @input into cache only, the record expires after @lifetime.
+// Zero @lifetime keeps session cache lifetime.
+func (s *Session) WriteCache(key string, input io.Reader, lifetime time.Duration) <-chan Lookuper {
+	return s.WriteCacheCtx(context.Background(), key, input, lifetime)
+}
+
+// WriteCacheCtx is a WriteCache which is stopped when @ctx is done.
+func (s *Session) WriteCacheCtx(ctx context.Context, key string, input io.Reader, lifetime time.Duration,
+	options ...CallOption) <-chan Lookuper {
+	ekey, err := NewKey(key)
+	if err != nil {
+		responseCh := make(chan Lookuper, 1)
+		responseCh <- &lookupResult{err: err}
+		close(responseCh)
+		return responseCh
+	}
+	defer ekey.Free()
+
+	options = cacheOnly(options)
+	if lifetime != 0 {
+		options = append(options, WithCallOptions(&CallOptions{CacheLifetime: lifetime}))
+	}
+
+	return s.WriteKeyCtx(ctx, ekey, input, 0, 0, options...)
+}
+
+// ReadCache reads the record from cache only, the disk is not touched.
+func (s *Session) ReadCache(key string, offset, size uint64) <-chan ReadResult {
+	return s.ReadCacheCtx(context.Background(), key, offset, size)
+}
+
+// ReadCacheCtx is a ReadCache which is stopped when @ctx is done.
+func (s *Session) ReadCacheCtx(ctx context.Context, key string, offset, size uint64, options ...CallOption) <-chan ReadResult {
+	return s.ReadDataCtx(ctx, key, offset, size, cacheOnly(options)...)
+}
+
+// RemoveCache removes the record from cache only, the disk is not touched.
+func (s *Session) RemoveCache(key string) <-chan Remover {
+	return s.RemoveCacheCtx(context.Background(), key)
+}
+
+// RemoveCacheCtx is a RemoveCache which is stopped when @ctx is done.
+func (s *Session) RemoveCacheCtx(ctx context.Context, key string, options ...CallOption) <-chan Remover {
+	return s.RemoveCtx(ctx, key, cacheOnly(options)...)
+}
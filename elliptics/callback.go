@@ -12,6 +12,11 @@ import (
 //export go_final_callback
 func go_final_callback(cerr *C.struct_go_error, key uint64) {
 	context, err := Pool.Get(uint64(key))
+	if err == ContextCancelledError {
+		// operation has been cancelled from Go side, this is the last reply for it
+		Pool.Delete(key)
+		return
+	}
 	if err != nil {
 		panic("Unable to find final callback")
 	}
@@ -33,6 +38,9 @@ func go_final_callback(cerr *C.struct_go_error, key uint64) {
 //export go_lookup_error
 func go_lookup_error(cmd *C.struct_dnet_cmd, addr *C.struct_dnet_addr, cerr *C.struct_go_error, key uint64) {
 	context, err := Pool.Get(key)
+	if err == ContextCancelledError {
+		return
+	}
 	if err != nil {
 		panic("Unable to find lookup callback")
 	}
@@ -53,6 +61,9 @@ func go_lookup_error(cmd *C.struct_dnet_cmd, addr *C.struct_dnet_addr, cerr *C.s
 //export go_lookup_callback
 func go_lookup_callback(result *C.struct_go_lookup_result, key uint64) {
 	context, err := Pool.Get(key)
+	if err == ContextCancelledError {
+		return
+	}
 	if err != nil {
 		panic("Unable to find lookup callback")
 	}
@@ -72,6 +83,9 @@ func go_lookup_callback(result *C.struct_go_lookup_result, key uint64) {
 //export go_remove_callback
 func go_remove_callback(result *C.struct_go_remove_result, key uint64) {
 	context, err := Pool.Get(key)
+	if err == ContextCancelledError {
+		return
+	}
 	if err != nil {
 		panic("Unable to find remove callback")
 	}
@@ -86,6 +100,9 @@ func go_remove_callback(result *C.struct_go_remove_result, key uint64) {
 //export go_read_error
 func go_read_error(cmd *C.struct_dnet_cmd, addr *C.struct_dnet_addr, cerr *C.struct_go_error, key uint64) {
 	context, err := Pool.Get(key)
+	if err == ContextCancelledError {
+		return
+	}
 	if err != nil {
 		panic("Unable to find read callback")
 	}
@@ -106,6 +123,9 @@ func go_read_error(cmd *C.struct_dnet_cmd, addr *C.struct_dnet_addr, cerr *C.str
 //export go_read_callback
 func go_read_callback(result *C.struct_go_read_result, key uint64, buffer_key uint64) {
 	context, err := Pool.Get(key)
+	if err == ContextCancelledError {
+		return
+	}
 	if err != nil {
 		panic("Unable to find read callback")
 	}
@@ -120,6 +140,9 @@ func go_read_callback(result *C.struct_go_read_result, key uint64, buffer_key ui
 
 	if buffer_key != 0 {
 		buffer_context, err := Pool.Get(buffer_key)
+		if err == ContextCancelledError {
+			return
+		}
 		if err != nil {
 			panic("Unable to find buffer key context")
 		}
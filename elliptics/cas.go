@@ -0,0 +1,199 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+/*
+#include "session.h"
+*/
+import "C"
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"errors"
+	"io"
+	"time"
+	"unsafe"
+)
+
+// casConflict converts CAS mismatch reply error into CASConflictError, other errors are returned as is.
+func casConflict(group uint32, err error) error {
+	if ke, ok := err.(*DnetError); ok && ke.Is(ErrCASConflict) {
+		return &CASConflictError{
+			DnetError: *ke,
+			Group:     group,
+		}
+	}
+
+	return err
+}
+
+// Checksum returns checksum of @data which is compared with the checksum of the stored record by WriteCAS.
+func Checksum(data []byte) []byte {
+	csum := sha512.Sum512(data)
+	return csum[:]
+}
+
+// WriteCAS writes data from @input only if checksum of the stored record equals to @csum,
+// groups where it does not hold reply with CASConflictError.
+// Zero @csum is used for records which do not exist yet.
+func (s *Session) WriteCAS(key string, input io.Reader, offset uint64, csum []byte) <-chan Lookuper {
+	return s.WriteCASCtx(context.Background(), key, input, offset, csum)
+}
+
+// WriteCASCtx is a WriteCAS which is stopped when @ctx is done.
+func (s *Session) WriteCASCtx(ctx context.Context, key string, input io.Reader, offset uint64, csum []byte,
+	options ...CallOption) <-chan Lookuper {
+	ekey, err := NewKey(key)
+	if err != nil {
+		responseCh := make(chan Lookuper, 1)
+		responseCh <- &lookupResult{err: err}
+		close(responseCh)
+		return responseCh
+	}
+	defer ekey.Free()
+
+	var ccsum [C.DNET_ID_SIZE]C.uint8_t
+	for i := 0; i < len(csum) && i < len(ccsum); i++ {
+		ccsum[i] = C.uint8_t(csum[i])
+	}
+
+	return s.writeKeyCtx(ctx, callOptions(options), ekey, input, true,
+		func(session *Session, onWriteContext, onWriteFinishContext uint64, chunk []byte) {
+			C.session_write_cas(session.session,
+				C.context_t(onWriteContext), C.context_t(onWriteFinishContext),
+				ekey.key, &ccsum[0], C.uint64_t(offset),
+				(*C.char)(unsafe.Pointer(&chunk[0])), C.uint64_t(len(chunk)))
+		})
+}
+
+// WriteCASTimestamp writes data from @input with timestamp @ts only if the stored record is older than @ts,
+// groups where it does not hold reply with CASConflictError.
+func (s *Session) WriteCASTimestamp(key string, input io.Reader, offset uint64, ts time.Time) <-chan Lookuper {
+	return s.WriteCASTimestampCtx(context.Background(), key, input, offset, ts)
+}
+
+// WriteCASTimestampCtx is a WriteCASTimestamp which is stopped when @ctx is done.
+func (s *Session) WriteCASTimestampCtx(ctx context.Context, key string, input io.Reader, offset uint64, ts time.Time,
+	options ...CallOption) <-chan Lookuper {
+	ekey, err := NewKey(key)
+	if err != nil {
+		responseCh := make(chan Lookuper, 1)
+		responseCh <- &lookupResult{err: err}
+		close(responseCh)
+		return responseCh
+	}
+	defer ekey.Free()
+
+	opts := callOptions(options).clone()
+	opts.IOflags |= DNET_IO_FLAGS_CAS_TIMESTAMP
+	opts.Timestamp = ts
+
+	return s.writeKeyCtx(ctx, opts, ekey, input, true,
+		func(session *Session, onWriteContext, onWriteFinishContext uint64, chunk []byte) {
+			C.session_write_data(session.session,
+				C.context_t(onWriteContext), C.context_t(onWriteFinishContext),
+				ekey.key, C.uint64_t(offset),
+				(*C.char)(unsafe.Pointer(&chunk[0])), C.uint64_t(len(chunk)))
+		})
+}
+
+// ReadModifyWrite reads the object, passes its data to @modify and writes the result back with WriteCAS.
+// If another writer has changed the object in between, the whole sequence is repeated up to @retries times.
+// @modify gets nil data if the object does not exist.
+//
+// Every group checks CAS condition on its own, so when the conflict is detected in some groups only,
+// other groups already have the new data. Such write is not repeated, since @modify would be applied
+// to those groups twice, PartialCASConflictError naming the groups which have accepted the write is returned
+// together with the results instead.
+func (c *Client) ReadModifyWrite(key string, retries int, modify func(data []byte) ([]byte, error)) ([]GroupResult, error) {
+	return c.ReadModifyWriteCtx(context.Background(), key, retries, modify)
+}
+
+// ReadModifyWriteCtx is a ReadModifyWrite which gives up when @ctx is done.
+func (c *Client) ReadModifyWriteCtx(ctx context.Context, key string, retries int,
+	modify func(data []byte) ([]byte, error)) ([]GroupResult, error) {
+	session, err := CloneSession(c.session)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Delete()
+	session.SetFilter(SessionFilterAll)
+
+	var (
+		results  []GroupResult
+		conflict error
+	)
+	for attempt := 0; attempt <= retries; attempt++ {
+		data, _, err := c.GetCtx(ctx, key)
+
+		csum := make([]byte, C.DNET_ID_SIZE)
+		switch {
+		case err == nil:
+			csum = Checksum(data)
+		case errors.Is(err, ErrNotFound):
+			data = nil
+		default:
+			return nil, err
+		}
+
+		update, err := modify(data)
+		if err != nil {
+			return nil, err
+		}
+
+		var (
+			errs *MultiError
+			good int
+		)
+		results, errs, good = collectWrites(session.WriteCASCtx(ctx, key, bytes.NewReader(update), 0, csum))
+
+		conflict = nil
+		if IsCASConflict(errs) {
+			conflict = errs
+		}
+
+		if conflict != nil && good != 0 {
+			accepted := make([]uint32, 0, good)
+			for _, r := range results {
+				if r.Err == nil {
+					accepted = append(accepted, r.Group)
+				}
+			}
+
+			return results, &PartialCASConflictError{
+				Accepted: accepted,
+				Err:      errs,
+			}
+		}
+
+		if conflict != nil {
+			if ctx.Err() != nil {
+				return results, ctx.Err()
+			}
+			continue
+		}
+
+		if good == 0 {
+			return results, errs.failure()
+		}
+
+		return results, nil
+	}
+
+	return results, conflict
+}
@@ -0,0 +1,276 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+/*
+Client is a blocking convenience layer on top of Session.
+
+Its methods drain result channels and combine per-group replies into plain values:
+
+	Get     returns the first successful read reply.
+	Put     returns outcome of every group, it fails only if no group has accepted the data.
+	Delete  succeeds if the key has been removed from at least one group.
+	Stat    looks the key up in all groups in parallel and returns the freshest replica.
+
+When no reply succeeded, MultiError with failures of all groups is returned, its ErrorCode() is chosen
+as follows: the first error which is neither -ENOENT nor -ETIMEDOUT, otherwise -ETIMEDOUT if any group
+timed out, otherwise -ENOENT.
+*/
+type Client struct {
+	session *Session
+	latency *LatencyTracker
+}
+
+// NewClient returns blocking client which sends requests through @session.
+func NewClient(session *Session) *Client {
+	return &Client{
+		session: session,
+		latency: NewLatencyTracker(defaultLatencyWindow),
+	}
+}
+
+// Session returns session used by the client.
+func (c *Client) Session() *Session {
+	return c.session
+}
+
+// Latency returns tracker of server latencies observed by the client.
+func (c *Client) Latency() *LatencyTracker {
+	return c.latency
+}
+
+// ObjectInfo describes one replica of the object.
+type ObjectInfo struct {
+	Group   uint32
+	Addr    DnetAddr
+	Backend int32
+
+	// Size is the whole record size, not the size of the data returned by read
+	Size        uint64
+	Mtime       time.Time
+	Csum        []byte
+	Path        string
+	RecordFlags uint64
+	UserFlags   uint64
+}
+
+func newObjectInfoRead(r ReadResult) ObjectInfo {
+	return ObjectInfo{
+		Group:       r.Cmd().ID.Group,
+		Addr:        *r.Addr(),
+		Backend:     r.Cmd().Backend,
+		Size:        r.IO().TotalSize,
+		Mtime:       r.IO().Timestamp,
+		RecordFlags: r.IO().RecordFlags,
+		UserFlags:   r.IO().UserFlags,
+	}
+}
+
+// Appended returns true if the record has been written by append (see Session.Append).
+func (info *ObjectInfo) Appended() bool {
+	return info.RecordFlags&DNET_RECORD_FLAGS_APPEND != 0
+}
+
+func newObjectInfoLookup(l Lookuper) ObjectInfo {
+	return ObjectInfo{
+		Group:   l.Cmd().ID.Group,
+		Addr:    *l.Addr(),
+		Backend: l.Cmd().Backend,
+		Size:    l.Info().Size,
+		Mtime:   l.Info().Mtime,
+		Csum:    l.Info().Csum,
+		Path:    l.Path(),
+	}
+}
+
+// GroupResult is an outcome of the operation in one group.
+type GroupResult struct {
+	Group   uint32
+	Addr    DnetAddr
+	Backend int32
+
+	// Status is the status of the server reply (DnetCmd.Status)
+	Status int32
+
+	// Attempts is the number of attempts made according to RetryPolicy
+	Attempts int
+
+	Info ObjectInfo
+	Err  error
+}
+
+// Get reads the whole object.
+func (c *Client) Get(key string) ([]byte, ObjectInfo, error) {
+	return c.GetCtx(context.Background(), key)
+}
+
+// GetCtx reads the whole object, it gives up when @ctx is done.
+func (c *Client) GetCtx(ctx context.Context, key string, options ...CallOption) ([]byte, ObjectInfo, error) {
+	errs := &MultiError{}
+
+	for rd := range c.session.ReadDataCtx(ctx, key, 0, 0, options...) {
+		if err := rd.Error(); err != nil {
+			errs.add(rd.Cmd().ID.Group, rd.Addr(), rd.Cmd().Backend, err)
+			continue
+		}
+
+		return rd.Data(), newObjectInfoRead(rd), nil
+	}
+
+	return nil, ObjectInfo{}, errs.failure()
+}
+
+// Put writes @size bytes from @input and returns outcome of every group.
+func (c *Client) Put(key string, input io.Reader, size uint64) ([]GroupResult, error) {
+	return c.PutCtx(context.Background(), key, input, size)
+}
+
+// PutCtx is a Put which gives up when @ctx is done.
+func (c *Client) PutCtx(ctx context.Context, key string, input io.Reader, size uint64, options ...CallOption) ([]GroupResult, error) {
+	// negative replies are needed to report failed groups
+	session, err := CloneSession(c.session)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Delete()
+	session.SetFilter(SessionFilterAll)
+
+	results, errs, good := collectWrites(session.WriteDataCtx(ctx, key, input, 0, size, options...))
+	if good == 0 {
+		return results, errs.failure()
+	}
+
+	return results, nil
+}
+
+// collectWrites drains write replies into per-group results, it also returns all failures and the number of successful groups.
+func collectWrites(replies <-chan Lookuper) ([]GroupResult, *MultiError, int) {
+	results := make([]GroupResult, 0)
+	errs := &MultiError{}
+	good := 0
+
+	for wr := range replies {
+		err := wr.Error()
+		if err != nil {
+			errs.add(wr.Cmd().ID.Group, wr.Addr(), wr.Cmd().Backend, err)
+
+			// overall operation error has no server reply attached
+			if wr.Cmd().ID.Group == 0 {
+				continue
+			}
+		} else {
+			good++
+		}
+
+		res := GroupResult{
+			Group:    wr.Cmd().ID.Group,
+			Addr:     *wr.Addr(),
+			Backend:  wr.Cmd().Backend,
+			Status:   wr.Cmd().Status,
+			Attempts: Attempts(wr),
+			Err:      err,
+		}
+		if err == nil {
+			res.Info = newObjectInfoLookup(wr)
+		}
+
+		results = append(results, res)
+	}
+
+	return results, errs, good
+}
+
+// Delete removes the object from all groups.
+func (c *Client) Delete(key string) error {
+	return c.DeleteCtx(context.Background(), key)
+}
+
+// DeleteCtx is a Delete which gives up when @ctx is done.
+func (c *Client) DeleteCtx(ctx context.Context, key string, options ...CallOption) error {
+	errs := &MultiError{}
+	good := 0
+
+	for rm := range c.session.RemoveCtx(ctx, key, options...) {
+		if err := rm.Error(); err != nil {
+			errs.add(rm.Cmd().ID.Group, nil, rm.Cmd().Backend, err)
+			continue
+		}
+
+		if status := rm.Cmd().Status; status != 0 {
+			errs.add(rm.Cmd().ID.Group, nil, rm.Cmd().Backend, &DnetError{
+				Code:    int(status),
+				Flags:   rm.Cmd().Flags,
+				Message: fmt.Sprintf("remove failed in group %d", rm.Cmd().ID.Group),
+			})
+			continue
+		}
+
+		good++
+	}
+
+	if good == 0 {
+		return errs.failure()
+	}
+
+	return nil
+}
+
+// Stat returns information about the freshest replica of the object.
+func (c *Client) Stat(key string) (ObjectInfo, error) {
+	return c.StatCtx(context.Background(), key)
+}
+
+// StatCtx is a Stat which gives up when @ctx is done.
+func (c *Client) StatCtx(ctx context.Context, key string, options ...CallOption) (ObjectInfo, error) {
+	// negative replies are needed to report failed groups
+	session, err := CloneSession(c.session)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer session.Delete()
+	session.SetFilter(SessionFilterAll)
+
+	errs := &MultiError{}
+	var info ObjectInfo
+	found := false
+
+	for l := range session.ParallelLookupCtx(ctx, key, options...) {
+		if err := l.Error(); err != nil {
+			errs.add(l.Cmd().ID.Group, l.Addr(), l.Cmd().Backend, err)
+			continue
+		}
+
+		tmp := newObjectInfoLookup(l)
+		if !found || tmp.Mtime.After(info.Mtime) ||
+			(tmp.Mtime.Equal(info.Mtime) && tmp.Size > info.Size) {
+			info = tmp
+			found = true
+		}
+	}
+
+	if !found {
+		return ObjectInfo{}, errs.failure()
+	}
+
+	return info, nil
+}
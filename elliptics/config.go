@@ -0,0 +1,506 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultConfigEnvPrefix is the prefix of environment variables read by LoadConfig.
+const DefaultConfigEnvPrefix = "ELLIPTICS_"
+
+// Duration is time.Duration which is read from config as a string like "1m30s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// LogConfig configures logs of the client library and of this package.
+type LogConfig struct {
+	// Output is "stderr" (default), "stdout" or path of the log file
+	Output string `json:"output" yaml:"output"`
+
+	// Format is "text" (default) or "json", JSON records are written one per line
+	Format string `json:"format" yaml:"format"`
+
+	// Level is one of "debug", "notice", "info" (default), "warning", "error"
+	Level string `json:"level" yaml:"level"`
+}
+
+// NodeSettings configure threads and timeouts of the Node, zero values mean defaults of NewNode.
+type NodeSettings struct {
+	IOThreads            int      `json:"io-threads" yaml:"io-threads"`
+	NonBlockingIOThreads int      `json:"nonblocking-io-threads" yaml:"nonblocking-io-threads"`
+	NetThreads           int      `json:"net-threads" yaml:"net-threads"`
+	WaitTimeout          Duration `json:"wait-timeout" yaml:"wait-timeout"`
+	CheckTimeout         Duration `json:"check-timeout" yaml:"check-timeout"`
+	Flags                int      `json:"flags" yaml:"flags"`
+	StallCount           int      `json:"stall-count" yaml:"stall-count"`
+}
+
+// SessionSettings are defaults of the sessions created from config.
+type SessionSettings struct {
+	Groups    []uint32 `json:"groups" yaml:"groups"`
+	Namespace string   `json:"namespace" yaml:"namespace"`
+
+	// flag names, see ParseCflags and ParseIOflags
+	Cflags  []string `json:"cflags" yaml:"cflags"`
+	IOflags []string `json:"ioflags" yaml:"ioflags"`
+
+	// Timeout of session requests, zero keeps elliptics default
+	Timeout Duration `json:"timeout" yaml:"timeout"`
+}
+
+/*
+ClientConfig describes connection to elliptics cluster, it is read from JSON or YAML file and environment:
+
+	remotes: ["host1:1025:2", "host2:1025:2"]
+	log: {output: stdout, format: json, level: info}
+	node: {io-threads: 8, wait-timeout: 15s, check-timeout: 30s}
+	session: {groups: [1, 2, 3], namespace: ns, cflags: [nocache], ioflags: [nocsum], timeout: 5s}
+
+Environment variables override file settings, see ApplyEnv.
+*/
+type ClientConfig struct {
+	Remotes []string        `json:"remotes" yaml:"remotes"`
+	Log     LogConfig       `json:"log" yaml:"log"`
+	Node    NodeSettings    `json:"node" yaml:"node"`
+	Session SessionSettings `json:"session" yaml:"session"`
+}
+
+// ParseConfig reads config from @data in @format, which is "json" or "yaml".
+func ParseConfig(data []byte, format string) (*ClientConfig, error) {
+	cfg := &ClientConfig{}
+
+	var err error
+	switch strings.ToLower(format) {
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	case "yaml", "yml":
+		err = yaml.UnmarshalStrict(data, cfg)
+	default:
+		return nil, fmt.Errorf("config: unknown format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: could not parse %s: %v", format, err)
+	}
+
+	return cfg, nil
+}
+
+// LoadConfig reads config file @path, format is chosen by the file extension (.json, .yaml or .yml),
+// applies environment variables with DefaultConfigEnvPrefix and validates the result.
+func LoadConfig(path string) (*ClientConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %v", err)
+	}
+
+	cfg, err := ParseConfig(data, strings.TrimPrefix(filepath.Ext(path), "."))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.ApplyEnv(DefaultConfigEnvPrefix); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func splitList(value string) []string {
+	ret := make([]string, 0)
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			ret = append(ret, s)
+		}
+	}
+
+	return ret
+}
+
+func parseGroups(value string) ([]uint32, error) {
+	groups := make([]uint32, 0)
+	for _, s := range splitList(value) {
+		group, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid group: %s", s)
+		}
+		groups = append(groups, uint32(group))
+	}
+
+	return groups, nil
+}
+
+func setInt(dst *int) func(string) error {
+	return func(value string) error {
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid number: %s", value)
+		}
+		*dst = v
+		return nil
+	}
+}
+
+func setString(dst *string) func(string) error {
+	return func(value string) error {
+		*dst = value
+		return nil
+	}
+}
+
+func setList(dst *[]string) func(string) error {
+	return func(value string) error {
+		*dst = splitList(value)
+		return nil
+	}
+}
+
+func setDuration(dst *Duration) func(string) error {
+	return func(value string) error {
+		return dst.UnmarshalText([]byte(value))
+	}
+}
+
+// ApplyEnv overrides config with environment variables @prefix + name, lists are comma-separated:
+//
+//	REMOTES, LOG_OUTPUT, LOG_FORMAT, LOG_LEVEL,
+//	NODE_IO_THREADS, NODE_NONBLOCKING_IO_THREADS, NODE_NET_THREADS,
+//	NODE_WAIT_TIMEOUT, NODE_CHECK_TIMEOUT, NODE_FLAGS, NODE_STALL_COUNT,
+//	SESSION_GROUPS, SESSION_NAMESPACE, SESSION_CFLAGS, SESSION_IOFLAGS, SESSION_TIMEOUT
+func (cfg *ClientConfig) ApplyEnv(prefix string) error {
+	vars := []struct {
+		name string
+		set  func(value string) error
+	}{
+		{"REMOTES", setList(&cfg.Remotes)},
+		{"LOG_OUTPUT", setString(&cfg.Log.Output)},
+		{"LOG_FORMAT", setString(&cfg.Log.Format)},
+		{"LOG_LEVEL", setString(&cfg.Log.Level)},
+		{"NODE_IO_THREADS", setInt(&cfg.Node.IOThreads)},
+		{"NODE_NONBLOCKING_IO_THREADS", setInt(&cfg.Node.NonBlockingIOThreads)},
+		{"NODE_NET_THREADS", setInt(&cfg.Node.NetThreads)},
+		{"NODE_WAIT_TIMEOUT", setDuration(&cfg.Node.WaitTimeout)},
+		{"NODE_CHECK_TIMEOUT", setDuration(&cfg.Node.CheckTimeout)},
+		{"NODE_FLAGS", setInt(&cfg.Node.Flags)},
+		{"NODE_STALL_COUNT", setInt(&cfg.Node.StallCount)},
+		{"SESSION_GROUPS", func(value string) (err error) {
+			cfg.Session.Groups, err = parseGroups(value)
+			return
+		}},
+		{"SESSION_NAMESPACE", setString(&cfg.Session.Namespace)},
+		{"SESSION_CFLAGS", setList(&cfg.Session.Cflags)},
+		{"SESSION_IOFLAGS", setList(&cfg.Session.IOflags)},
+		{"SESSION_TIMEOUT", setDuration(&cfg.Session.Timeout)},
+	}
+
+	for _, v := range vars {
+		value, ok := os.LookupEnv(prefix + v.name)
+		if !ok {
+			continue
+		}
+
+		if err := v.set(value); err != nil {
+			return fmt.Errorf("config: %s%s: %v", prefix, v.name, err)
+		}
+	}
+
+	return nil
+}
+
+func validateRemote(remote string) error {
+	host, port, _, err := splitRemote(remote)
+	if err != nil || host == "" {
+		return fmt.Errorf("must be host:port or host:port:family")
+	}
+
+	// only IPv6 address may contain colons, otherwise family is neither 2 (AF_INET) nor 10 (AF_INET6)
+	if strings.Contains(host, ":") && net.ParseIP(host) == nil {
+		return fmt.Errorf("must be host:port or host:port:family, family is 2 (AF_INET) or 10 (AF_INET6)")
+	}
+
+	if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+		return fmt.Errorf("invalid port: %s", port)
+	}
+
+	return nil
+}
+
+// Validate checks config and returns error describing the first invalid setting.
+func (cfg *ClientConfig) Validate() error {
+	if len(cfg.Remotes) == 0 {
+		return fmt.Errorf("config: remotes: at least one remote is required")
+	}
+	for _, remote := range cfg.Remotes {
+		if err := validateRemote(remote); err != nil {
+			return fmt.Errorf("config: remotes: %s: %v", remote, err)
+		}
+	}
+
+	switch strings.ToLower(cfg.Log.Format) {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("config: log.format: unknown format: %s, must be text or json", cfg.Log.Format)
+	}
+	if cfg.Log.Level != "" {
+		if _, err := ParseLogLevel(cfg.Log.Level); err != nil {
+			return fmt.Errorf("config: log.level: %v", err)
+		}
+	}
+
+	threads := []struct {
+		name  string
+		value int
+	}{
+		{"node.io-threads", cfg.Node.IOThreads},
+		{"node.nonblocking-io-threads", cfg.Node.NonBlockingIOThreads},
+		{"node.net-threads", cfg.Node.NetThreads},
+		{"node.stall-count", cfg.Node.StallCount},
+	}
+	for _, t := range threads {
+		if t.value < 0 {
+			return fmt.Errorf("config: %s: must not be negative: %d", t.name, t.value)
+		}
+	}
+
+	timeouts := []struct {
+		name  string
+		value Duration
+	}{
+		{"node.wait-timeout", cfg.Node.WaitTimeout},
+		{"node.check-timeout", cfg.Node.CheckTimeout},
+		{"session.timeout", cfg.Session.Timeout},
+	}
+	for _, t := range timeouts {
+		if t.value < 0 {
+			return fmt.Errorf("config: %s: must not be negative: %v", t.name, time.Duration(t.value))
+		}
+	}
+
+	if len(cfg.Session.Groups) == 0 {
+		return fmt.Errorf("config: session.groups: at least one group is required")
+	}
+	if _, err := ParseCflags(cfg.Session.Cflags); err != nil {
+		return fmt.Errorf("config: session.cflags: %v", err)
+	}
+	if _, err := ParseIOflags(cfg.Session.IOflags); err != nil {
+		return fmt.Errorf("config: session.ioflags: %v", err)
+	}
+
+	return nil
+}
+
+// durationSeconds rounds non-zero duration up to whole seconds.
+func durationSeconds(d Duration) uint64 {
+	if d == 0 {
+		return 0
+	}
+
+	return uint64(timeoutFromDuration(time.Duration(d)))
+}
+
+func (cfg *ClientConfig) nodeConfig() *NodeConfig {
+	ncfg := DefaultNodeConfig()
+
+	if cfg.Node.IOThreads != 0 {
+		ncfg.IOThreadNum = cfg.Node.IOThreads
+	}
+	if cfg.Node.NonBlockingIOThreads != 0 {
+		ncfg.NonBlockingIOThreadNum = cfg.Node.NonBlockingIOThreads
+	}
+	if cfg.Node.NetThreads != 0 {
+		ncfg.NetThreadNum = cfg.Node.NetThreads
+	}
+	if cfg.Node.WaitTimeout != 0 {
+		ncfg.WaitTimeout = durationSeconds(cfg.Node.WaitTimeout)
+	}
+	if cfg.Node.CheckTimeout != 0 {
+		ncfg.CheckTimeout = durationSeconds(cfg.Node.CheckTimeout)
+	}
+	ncfg.Flags = cfg.Node.Flags
+	ncfg.StallCount = cfg.Node.StallCount
+
+	return ncfg
+}
+
+// logger returns Go logger for the log settings, nil if the client library should write into a file itself.
+// If the logger writes into a file, the file is returned too and must be closed once the logger is not used.
+func (cfg *ClientConfig) logger() (Logger, io.Closer, error) {
+	level := LogInfo
+	if cfg.Log.Level != "" {
+		var err error
+		if level, err = ParseLogLevel(cfg.Log.Level); err != nil {
+			return nil, nil, fmt.Errorf("config: log.level: %v", err)
+		}
+	}
+
+	var out io.Writer
+	switch cfg.Log.Output {
+	case "", "stderr":
+		out = os.Stderr
+	case "stdout":
+		out = os.Stdout
+	}
+
+	if strings.ToLower(cfg.Log.Format) == "json" {
+		if out == nil {
+			f, err := os.OpenFile(cfg.Log.Output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+			if err != nil {
+				return nil, nil, fmt.Errorf("config: log.output: %v", err)
+			}
+
+			return NewJSONLogger(f, level), f, nil
+		}
+
+		return NewJSONLogger(out, level), nil, nil
+	}
+
+	if out == nil {
+		return nil, nil, nil
+	}
+
+	return NewStdLogger(log.New(out, "", log.LstdFlags), level), nil, nil
+}
+
+// NewNode creates Node and connects it to the remotes.
+// If logs go to stdout, stderr or are formatted as JSON, the same logger is set as the package logger (see SetLogger).
+// JSON log file is closed by Node.Free(), records written by the package logger after that are lost.
+func (cfg *ClientConfig) NewNode() (*Node, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	level := cfg.Log.Level
+	if level == "" {
+		level = LogInfo.String()
+	}
+	level = strings.ToLower(level)
+
+	logger, logfile, err := cfg.logger()
+	if err != nil {
+		return nil, err
+	}
+
+	var node *Node
+	if logger != nil {
+		node, err = NewNodeLogger(logger, level, cfg.nodeConfig())
+	} else {
+		node, err = NewNodeConfig(cfg.Log.Output, level, cfg.nodeConfig())
+	}
+	if err != nil {
+		if logfile != nil {
+			logfile.Close()
+		}
+		return nil, err
+	}
+	node.logfile = logfile
+
+	if err := node.AddRemotes(cfg.Remotes); err != nil {
+		node.Free()
+		return nil, fmt.Errorf("config: could not connect to remotes %v: %v", cfg.Remotes, err)
+	}
+
+	// package logger is replaced only when the node is returned, since Free() closes its log file
+	if logger != nil {
+		SetLogger(logger)
+	}
+
+	return node, nil
+}
+
+// ApplySession sets session defaults from config on @s.
+func (cfg *ClientConfig) ApplySession(s *Session) error {
+	cflags, err := ParseCflags(cfg.Session.Cflags)
+	if err != nil {
+		return fmt.Errorf("config: session.cflags: %v", err)
+	}
+	ioflags, err := ParseIOflags(cfg.Session.IOflags)
+	if err != nil {
+		return fmt.Errorf("config: session.ioflags: %v", err)
+	}
+
+	if len(cfg.Session.Groups) != 0 {
+		s.SetGroups(append([]uint32(nil), cfg.Session.Groups...))
+	}
+	if cfg.Session.Namespace != "" {
+		s.SetNamespace(cfg.Session.Namespace)
+	}
+	if cflags != 0 {
+		s.SetCflags(cflags)
+	}
+	if ioflags != 0 {
+		s.SetIOflags(ioflags)
+	}
+	if cfg.Session.Timeout != 0 {
+		s.SetTimeout(timeoutFromDuration(time.Duration(cfg.Session.Timeout)))
+	}
+
+	return nil
+}
+
+// NewFromConfig creates Node connected to the remotes of @cfg and Session with its defaults.
+// Session must be deleted and Node freed by the caller.
+func NewFromConfig(cfg *ClientConfig) (*Node, *Session, error) {
+	node, err := cfg.NewNode()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session, err := NewSession(node)
+	if err != nil {
+		node.Free()
+		return nil, nil, err
+	}
+
+	if err := cfg.ApplySession(session); err != nil {
+		session.Delete()
+		node.Free()
+		return nil, nil, err
+	}
+
+	return node, session, nil
+}
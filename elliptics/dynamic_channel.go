@@ -15,17 +15,31 @@
 
 package elliptics
 
+import (
+	"context"
+)
+
 type DChannel struct {
 	In		chan interface{}
 	Out		chan interface{}
 	buffer		[]interface{}
+
+	// when closed, buffered values are dropped and output channel is closed
+	done		<-chan struct{}
 }
 
 func NewDChannel() *DChannel {
+	return NewDChannelCtx(context.Background())
+}
+
+// NewDChannelCtx returns dynamic channel which stops forwarding values and closes its output channel
+// as soon as @ctx is done, so that abandoned readers do not leak the forwarding goroutine.
+func NewDChannelCtx(ctx context.Context) *DChannel {
 	dch := &DChannel {
 		In:		make(chan interface{}, defaultVOLUME),
 		Out:		make(chan interface{}, defaultVOLUME),
 		buffer:		make([]interface{}, 0),
+		done:		ctx.Done(),
 	}
 
 	// schedule reader
@@ -50,19 +64,31 @@ recv:
 				}
 
 				dch.buffer = append(dch.buffer, v)
+
+			case <-dch.done:
+				return
 			}
 		} else {
-			v, ok := <-dch.In
-			if !ok {
-				break recv
-			}
+			select {
+			case v, ok := <-dch.In:
+				if !ok {
+					break recv
+				}
 
-			dch.buffer = append(dch.buffer, v)
+				dch.buffer = append(dch.buffer, v)
+
+			case <-dch.done:
+				return
+			}
 		}
 	}
 
 	// if there is something we haven't yet pushed to the output channel
 	for _, v := range dch.buffer {
-		dch.Out <- v
+		select {
+		case dch.Out <- v:
+		case <-dch.done:
+			return
+		}
 	}
 }
@@ -1,8 +1,14 @@
 package elliptics
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"testing/iotest"
@@ -392,3 +398,1058 @@ func (s *SessionSuite) TestReader(c *C) {
 	// we are at the very end of the file, reading should fail
 	c.Check(err, Equals, io.EOF)
 }
+
+func (s *SessionSuite) TestCancelledContext(c *C) {
+	const testKey = "test-key"
+
+	s.session.SetGroups(s.groups)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for res := range s.session.ReadDataCtx(ctx, testKey, 0, 0) {
+		c.Assert(res.Error(), Equals, context.Canceled)
+	}
+
+	for res := range s.session.WriteDataCtx(ctx, testKey, strings.NewReader("data"), 0, 0) {
+		c.Assert(res.Error(), Equals, context.Canceled)
+	}
+
+	for res := range s.session.RemoveCtx(ctx, testKey) {
+		c.Assert(res.Error(), Equals, context.Canceled)
+	}
+
+	_, err := s.session.DnetStatCtx(ctx)
+	c.Assert(err, Equals, context.Canceled)
+}
+
+func (s *SessionSuite) TestContextDeadline(c *C) {
+	var (
+		testBlob                 = `MY_TEST_BLOB_WITH_DUMMY_DATA`
+		testKey                  = fmt.Sprintf("testkey-%d", time.Now().Unix())
+		testBlobReader io.Reader = strings.NewReader(testBlob)
+	)
+
+	s.session.SetGroups(s.groups)
+	s.session.SetTimeout(60)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for res := range s.session.WriteDataCtx(ctx, testKey, testBlobReader, 0, 0) {
+		c.Assert(res.Error(), IsNil)
+	}
+
+	for res := range s.session.ReadDataCtx(ctx, testKey, 0, 0) {
+		c.Assert(res.Error(), IsNil)
+		c.Assert(res.Data(), DeepEquals, []byte(testBlob))
+	}
+
+	// session timeout must not be changed by per-call deadline
+	c.Assert(s.session.GetTimeout(), Equals, 60)
+}
+
+func (s *SessionSuite) TestClient(c *C) {
+	var (
+		testBlob      = `MY_TEST_BLOB_WITH_DUMMY_DATA`
+		testKey       = fmt.Sprintf("testkey-client-%d", time.Now().Unix())
+		testNamespace = fmt.Sprintf("testnamespace-%d", time.Now().Unix())
+	)
+
+	s.session.SetGroups(s.groups)
+	s.session.SetNamespace(testNamespace)
+
+	client := NewClient(s.session)
+
+	_, _, err := client.Get(testKey)
+	c.Assert(ErrorCode(err), Equals, -2)
+
+	results, err := client.Put(testKey, strings.NewReader(testBlob), uint64(len(testBlob)))
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, len(s.groups))
+	for _, res := range results {
+		c.Check(res.Err, IsNil)
+		c.Check(res.Status, Equals, int32(0))
+		c.Check(res.Info.Size, Equals, uint64(len(testBlob)))
+	}
+
+	data, info, err := client.Get(testKey)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, testBlob)
+	c.Assert(info.Size, Equals, uint64(len(testBlob)))
+
+	info, err = client.Stat(testKey)
+	c.Assert(err, IsNil)
+	c.Assert(info.Size, Equals, uint64(len(testBlob)))
+
+	c.Assert(client.Delete(testKey), IsNil)
+
+	_, err = client.Stat(testKey)
+	c.Assert(ErrorCode(err), Equals, -2)
+
+	c.Assert(ErrorCode(client.Delete(testKey)), Equals, -2)
+}
+
+func (s *SessionSuite) TestSelectError(c *C) {
+	var (
+		noent   = &DnetError{Code: -2}
+		timeout = &DnetError{Code: -110}
+		io      = &DnetError{Code: -5}
+	)
+
+	c.Assert(selectError([]error{noent, timeout, io}), Equals, io)
+	c.Assert(selectError([]error{noent, timeout}), Equals, timeout)
+	c.Assert(selectError([]error{noent}), Equals, noent)
+	c.Assert(ErrorCode(selectError(nil)), Equals, -6)
+}
+
+func (s *SessionSuite) TestCloneIsIndependent(c *C) {
+	s.session.SetGroups(s.groups)
+	s.session.SetIOflags(DNET_IO_FLAGS_NOCSUM)
+
+	session, err := CloneSession(s.session)
+	c.Assert(err, IsNil)
+	defer session.Delete()
+
+	session.SetIOflags(DNET_IO_FLAGS_CACHE)
+	session.SetGroups(s.groups[:1])
+
+	c.Assert(s.session.GetIOflags(), Equals, DNET_IO_FLAGS_NOCSUM)
+	c.Assert(s.session.GetGroups(), DeepEquals, s.groups)
+}
+
+func (s *SessionSuite) TestUserFlags(c *C) {
+	const userFlags = uint64(0x1234)
+	s.session.SetUserFlags(userFlags)
+	c.Assert(s.session.GetUserFlags(), Equals, userFlags)
+}
+
+func (s *SessionSuite) TestCallOptions(c *C) {
+	var (
+		testBlob      = `MY_TEST_BLOB_WITH_DUMMY_DATA`
+		testKey       = fmt.Sprintf("testkey-options-%d", time.Now().Unix())
+		callTraceID   = TraceID(12345)
+		callUserFlags = uint64(0xf00)
+	)
+
+	s.session.SetGroups(s.groups)
+	s.session.SetIOflags(0)
+
+	opt := WithCallOptions(&CallOptions{
+		IOflags:   DNET_IO_FLAGS_NOCSUM,
+		Groups:    s.groups[:1],
+		Timeout:   30 * time.Second,
+		TraceID:   callTraceID,
+		UserFlags: callUserFlags,
+	})
+
+	results := 0
+	for res := range s.session.WriteDataCtx(context.Background(), testKey, strings.NewReader(testBlob), 0, 0, opt) {
+		c.Assert(res.Error(), IsNil)
+		c.Check(res.Cmd().ID.Group, Equals, s.groups[0])
+		c.Check(res.Cmd().Trace, Equals, uint64(callTraceID))
+		results++
+	}
+	c.Assert(results, Equals, 1)
+
+	for res := range s.session.ReadDataCtx(context.Background(), testKey, 0, 0, opt) {
+		c.Assert(res.Error(), IsNil)
+		c.Check(res.IO().UserFlags, Equals, callUserFlags)
+	}
+
+	// shared session is not modified
+	c.Assert(s.session.GetIOflags(), Equals, IOflag(0))
+	c.Assert(s.session.GetGroups(), DeepEquals, s.groups)
+	c.Assert(s.session.GetTraceID(), Not(Equals), callTraceID)
+	c.Assert(s.session.GetUserFlags(), Equals, uint64(0))
+}
+
+func (s *SessionSuite) TestIndexes(c *C) {
+	var (
+		testKey    = fmt.Sprintf("testkey-indexes-%d", time.Now().Unix())
+		firstIdx   = testKey + "-first"
+		secondIdx  = testKey + "-second"
+		firstData  = []byte("first index data")
+		secondData = []byte("second index data")
+	)
+
+	s.session.SetGroups(s.groups)
+
+	for res := range s.session.SetIndexes(testKey, map[string][]byte{
+		firstIdx:  firstData,
+		secondIdx: secondData,
+	}) {
+		c.Assert(res.Error(), IsNil)
+	}
+
+	found := 0
+	for res := range s.session.FindAllIndexes([]string{firstIdx, secondIdx}) {
+		c.Assert(res.Error(), IsNil)
+		c.Check(res.Entries(), HasLen, 2)
+		found++
+	}
+	c.Assert(found, Equals, 1)
+
+	listed := 0
+	for res := range s.session.ListIndexes(testKey) {
+		c.Assert(res.Error(), IsNil)
+		listed++
+	}
+	c.Assert(listed, Equals, 2)
+
+	for res := range s.session.RemoveIndexes(testKey, []string{firstIdx}) {
+		c.Assert(res.Error(), IsNil)
+	}
+
+	found = 0
+	for res := range s.session.FindAnyIndexes([]string{firstIdx, secondIdx}) {
+		c.Assert(res.Error(), IsNil)
+		c.Assert(res.Entries(), HasLen, 1)
+		c.Check(res.Entries()[0].Data, DeepEquals, secondData)
+		found++
+	}
+	c.Assert(found, Equals, 1)
+}
+
+func (s *SessionSuite) TestClientQuorum(c *C) {
+	var (
+		testBlob     = `MY_TEST_BLOB_WITH_DUMMY_DATA`
+		testKey      = fmt.Sprintf("testkey-quorum-%d", time.Now().Unix())
+		missingGroup = uint32(0xffff)
+	)
+
+	s.session.SetGroups(s.groups)
+	client := NewClient(s.session)
+
+	res, err := client.PutQuorum(testKey, strings.NewReader(testBlob), uint64(len(testBlob)), QuorumOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(res.Reached(), Equals, true)
+	c.Assert(res.Succeeded, HasLen, len(s.groups))
+	c.Assert(res.Failed, HasLen, 0)
+
+	// group without nodes can never accept the write, so the quorum of all groups is missed
+	groups := append(append([]uint32{}, s.groups...), missingGroup)
+	res, err = client.PutQuorumCtx(context.Background(), testKey, strings.NewReader(testBlob), uint64(len(testBlob)),
+		QuorumOptions{RemovePartial: true}, WithGroups(groups...))
+	c.Assert(err, FitsTypeOf, &QuorumError{})
+	c.Assert(res.Required, Equals, len(groups))
+	c.Assert(res.Succeeded, HasLen, len(s.groups))
+	c.Assert(res.Failed, HasLen, 1)
+	c.Assert(res.Failed[0].Group, Equals, missingGroup)
+	c.Assert(res.Removed, HasLen, len(s.groups))
+	for _, rm := range res.Removed {
+		c.Check(rm.Err, IsNil)
+	}
+
+	_, err = client.Stat(testKey)
+	c.Assert(ErrorCode(err), Equals, -2)
+
+	// quorum larger than the number of groups is a caller error, nothing is written
+	res, err = client.PutQuorum(testKey, strings.NewReader(testBlob), uint64(len(testBlob)),
+		QuorumOptions{Required: len(s.groups) + 1})
+	c.Assert(ErrorCode(err), Equals, -22)
+	c.Assert(res, IsNil)
+
+	_, err = client.Stat(testKey)
+	c.Assert(ErrorCode(err), Equals, -2)
+
+	// session without groups writes nothing, so even the default quorum is not reached
+	empty, err := NewSession(s.node)
+	c.Assert(err, IsNil)
+	defer empty.Delete()
+
+	res, err = NewClient(empty).PutQuorum(testKey, strings.NewReader(testBlob), uint64(len(testBlob)), QuorumOptions{})
+	c.Assert(errors.Is(err, ErrNoGroups), Equals, true)
+	c.Assert(res, IsNil)
+}
+
+func (s *SessionSuite) TestClientRepair(c *C) {
+	var (
+		testBlob = `MY_TEST_BLOB_WITH_DUMMY_DATA`
+		testKey  = fmt.Sprintf("testkey-repair-%d", time.Now().Unix())
+	)
+
+	s.session.SetGroups(s.groups)
+	client := NewClient(s.session)
+
+	_, err := client.PutCtx(context.Background(), testKey, strings.NewReader(testBlob), uint64(len(testBlob)),
+		WithGroups(s.groups[0]))
+	c.Assert(err, IsNil)
+
+	report := client.Repair(testKey)
+	c.Assert(report.Err, IsNil)
+	c.Assert(report.Source.Group, Equals, s.groups[0])
+	c.Assert(report.Stale, HasLen, len(s.groups)-1)
+	c.Assert(report.Repaired, HasLen, len(s.groups)-1)
+
+	for _, group := range s.groups {
+		data, info, err := client.GetCtx(context.Background(), testKey, WithGroups(group))
+		c.Assert(err, IsNil)
+		c.Check(string(data), Equals, testBlob)
+		c.Check(info.Mtime.Equal(report.Source.Mtime), Equals, true)
+	}
+
+	report = client.Repair(testKey)
+	c.Assert(report.Err, IsNil)
+	c.Assert(report.Stale, HasLen, 0)
+
+	reports := make(chan *RepairReport, 1)
+	repairer := NewRepairer(client, 1, 1, func(r *RepairReport) {
+		reports <- r
+	})
+	defer repairer.Close()
+
+	c.Assert(repairer.Schedule(testKey), Equals, true)
+	report = <-reports
+	c.Assert(report.Key, Equals, testKey)
+	c.Assert(report.Err, IsNil)
+}
+
+func (s *SessionSuite) TestClientHedged(c *C) {
+	var (
+		testBlob = `MY_TEST_BLOB_WITH_DUMMY_DATA`
+		testKey  = fmt.Sprintf("testkey-hedged-%d", time.Now().Unix())
+	)
+
+	s.session.SetGroups(s.groups)
+	client := NewClient(s.session)
+
+	// the key exists only in the last group, so the read has to move over all groups
+	_, err := client.PutCtx(context.Background(), testKey, strings.NewReader(testBlob), uint64(len(testBlob)),
+		WithGroups(s.groups[len(s.groups)-1]))
+	c.Assert(err, IsNil)
+
+	data, info, err := client.GetHedged(testKey, HedgeOptions{Delay: time.Second, Percentile: 0.95})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, testBlob)
+	c.Assert(info.Group, Equals, s.groups[len(s.groups)-1])
+
+	for _, group := range s.groups {
+		_, ok := client.Latency().Average(group)
+		c.Check(ok, Equals, true)
+	}
+
+	_, _, err = client.GetHedged(testKey+"-missing", HedgeOptions{})
+	c.Assert(ErrorCode(err), Equals, -2)
+
+	// unsampled groups are tried after sampled ones, abandoned reads slow the group down
+	tracker := NewLatencyTracker(0)
+	addr := DnetAddr{Addr: []byte{127, 0, 0, 1, 0, 0, 0, 0}, Family: 2}
+	tracker.Observe(1, &addr, 10*time.Millisecond)
+	c.Assert(tracker.Order([]uint32{3, 2, 1}), DeepEquals, []uint32{1, 3, 2})
+
+	tracker.ObserveLowerBound(3, 50*time.Millisecond)
+	c.Assert(tracker.Order([]uint32{3, 2, 1}), DeepEquals, []uint32{1, 3, 2})
+	avg, ok := tracker.Average(3)
+	c.Assert(ok, Equals, true)
+	c.Assert(avg, Equals, 50*time.Millisecond)
+
+	tracker.ObserveLowerBound(1, 300*time.Millisecond)
+	c.Assert(tracker.Order([]uint32{3, 2, 1}), DeepEquals, []uint32{3, 1, 2})
+}
+
+func (s *SessionSuite) TestWriteCAS(c *C) {
+	var (
+		testBlob = `MY_TEST_BLOB_WITH_DUMMY_DATA`
+		newBlob  = `MY_NEW_TEST_BLOB`
+		testKey  = fmt.Sprintf("testkey-cas-%d", time.Now().Unix())
+	)
+
+	s.session.SetGroups(s.groups)
+	client := NewClient(s.session)
+
+	_, err := client.Put(testKey, strings.NewReader(testBlob), uint64(len(testBlob)))
+	c.Assert(err, IsNil)
+
+	for wr := range s.session.WriteCAS(testKey, strings.NewReader(newBlob), 0, Checksum([]byte(newBlob))) {
+		c.Assert(IsCASConflict(wr.Error()), Equals, true)
+		c.Assert(ErrorCode(wr.Error()), Equals, -77)
+	}
+
+	for wr := range s.session.WriteCAS(testKey, strings.NewReader(newBlob), 0, Checksum([]byte(testBlob))) {
+		c.Assert(wr.Error(), IsNil)
+	}
+
+	info, err := client.Stat(testKey)
+	c.Assert(err, IsNil)
+
+	for wr := range s.session.WriteCASTimestamp(testKey, strings.NewReader(testBlob), 0, info.Mtime.Add(-time.Hour)) {
+		c.Assert(IsCASConflict(wr.Error()), Equals, true)
+	}
+
+	_, err = client.ReadModifyWrite(testKey, 3, func(data []byte) ([]byte, error) {
+		c.Assert(string(data), Equals, newBlob)
+		return []byte(testBlob), nil
+	})
+	c.Assert(err, IsNil)
+
+	data, _, err := client.Get(testKey)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, testBlob)
+
+	// replicas differ, whichever one is read, its checksum matches some groups only
+	for wr := range s.session.WriteDataCtx(context.Background(), testKey, strings.NewReader(newBlob), 0, 0,
+		WithGroups(s.groups[1:]...)) {
+		c.Assert(wr.Error(), IsNil)
+	}
+
+	calls := 0
+	results, err := client.ReadModifyWrite(testKey, 3, func(data []byte) ([]byte, error) {
+		calls++
+		return append(data, '!'), nil
+	})
+	c.Assert(IsCASConflict(err), Equals, true)
+	c.Assert(calls, Equals, 1)
+	c.Assert(results, HasLen, len(s.groups))
+
+	partial, ok := err.(*PartialCASConflictError)
+	c.Assert(ok, Equals, true)
+	c.Assert(len(partial.Accepted) > 0, Equals, true)
+	c.Assert(len(partial.Err.Errors) > 0, Equals, true)
+}
+
+func (s *SessionSuite) TestAppend(c *C) {
+	var (
+		testBlob = `MY_TEST_BLOB_WITH_DUMMY_DATA`
+		testKey  = fmt.Sprintf("testkey-append-%d", time.Now().Unix())
+	)
+
+	s.session.SetGroups(s.groups)
+
+	for wr := range s.session.Append(testKey, strings.NewReader(testBlob)) {
+		c.Assert(wr.Error(), IsNil)
+		c.Assert(wr.Info().Size, Equals, uint64(len(testBlob)))
+	}
+
+	appender, err := NewAppender(context.Background(), s.session, testKey, 2*len(testBlob))
+	c.Assert(err, IsNil)
+
+	_, err = appender.Write([]byte(testBlob))
+	c.Assert(err, IsNil)
+	c.Assert(appender.Size(), Equals, uint64(0))
+
+	_, err = appender.Write([]byte(testBlob))
+	c.Assert(err, IsNil)
+	c.Assert(appender.Size(), Equals, uint64(3*len(testBlob)))
+
+	_, err = appender.Write([]byte(testBlob))
+	c.Assert(err, IsNil)
+	c.Assert(appender.Close(), IsNil)
+	c.Assert(appender.Size(), Equals, uint64(4*len(testBlob)))
+
+	data, _, err := NewClient(s.session).Get(testKey)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, strings.Repeat(testBlob, 4))
+
+	// group without nodes can not accept appends, replicas diverge and appender reports it
+	session, err := CloneSession(s.session)
+	c.Assert(err, IsNil)
+	defer session.Delete()
+	session.SetGroups(append(append([]uint32{}, s.groups...), 0xffff))
+
+	appender, err = NewAppender(context.Background(), session, testKey, 0)
+	c.Assert(err, IsNil)
+	defer appender.Close()
+
+	_, err = appender.Write([]byte(testBlob))
+	c.Assert(err, IsNil)
+	size, err := appender.Flush()
+	c.Assert(err, FitsTypeOf, &MultiError{})
+	c.Assert(size, Equals, uint64(5*len(testBlob)))
+
+	failed := map[uint32]bool{}
+	for _, ge := range err.(*MultiError).Errors {
+		failed[ge.Group] = true
+	}
+	c.Assert(failed[0xffff], Equals, true)
+	for _, group := range s.groups {
+		c.Check(failed[group], Equals, false)
+	}
+
+	_, err = appender.Write([]byte(testBlob))
+	c.Assert(err, NotNil)
+}
+
+func (s *SessionSuite) TestCache(c *C) {
+	var (
+		testBlob = `MY_TEST_BLOB_WITH_DUMMY_DATA`
+		testKey  = fmt.Sprintf("testkey-cache-%d", time.Now().Unix())
+	)
+
+	s.session.SetGroups(s.groups)
+	ctx := context.Background()
+	opt := WithCallOptions(&CallOptions{ClearCflags: DNET_FLAGS_NOCACHE})
+
+	for wr := range s.session.WriteCacheCtx(ctx, testKey, strings.NewReader(testBlob), time.Minute, opt) {
+		c.Assert(wr.Error(), IsNil)
+	}
+
+	for rd := range s.session.ReadCacheCtx(ctx, testKey, 0, 0, opt) {
+		c.Assert(rd.Error(), IsNil)
+		c.Assert(string(rd.Data()), Equals, testBlob)
+	}
+
+	for rm := range s.session.RemoveCacheCtx(ctx, testKey, opt) {
+		c.Assert(rm.Error(), IsNil)
+	}
+
+	for rd := range s.session.ReadCacheCtx(ctx, testKey, 0, 0, opt) {
+		c.Assert(ErrorCode(rd.Error()), Equals, -2)
+	}
+
+	stat, err := s.session.DnetStatCategoriesCtx(context.Background(), DefaultStatCategories|StatCategoryCache)
+	c.Assert(err, IsNil)
+	c.Assert(stat.Group, HasLen, len(s.groups))
+	for _, sg := range stat.Group {
+		for _, sb := range sg.Ab {
+			c.Check(sb.VFS.Total > 0, Equals, true)
+			c.Check(sb.Cache.SizeLimit >= sb.Cache.Size, Equals, true)
+		}
+	}
+}
+
+func (s *SessionSuite) TestBulkRead(c *C) {
+	var (
+		testBlob   = `MY_TEST_BLOB_WITH_DUMMY_DATA`
+		testPrefix = fmt.Sprintf("testkey-bulk-read-%d", time.Now().Unix())
+		missingKey = testPrefix + "-missing"
+	)
+
+	s.session.SetGroups(s.groups)
+
+	keys := []string{missingKey}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("%s-%d", testPrefix, i)
+		for wr := range s.session.WriteData(key, strings.NewReader(key+testBlob), 0, 0) {
+			c.Assert(wr.Error(), IsNil)
+		}
+		keys = append(keys, key)
+	}
+
+	results, err := s.session.BulkRead(keys)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, len(keys))
+
+	for key, res := range results {
+		if key == missingKey {
+			c.Check(ErrorCode(res.Error()), Equals, -2)
+			continue
+		}
+
+		c.Assert(res.Error(), IsNil)
+		c.Check(string(res.Data()), Equals, key+testBlob)
+	}
+
+	// the key is missing in every group but the last one, the missing key is missing everywhere
+	partialKey := testPrefix + "-partial"
+	for wr := range s.session.WriteDataCtx(context.Background(), partialKey, strings.NewReader(testBlob), 0, 0,
+		WithGroups(s.groups[len(s.groups)-1])) {
+		c.Assert(wr.Error(), IsNil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	results, err = s.session.BulkReadCtx(ctx, []string{missingKey, partialKey})
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 2)
+	c.Assert(ErrorCode(results[missingKey].Error()), Equals, -2)
+	c.Assert(results[partialKey].Error(), IsNil)
+	c.Assert(string(results[partialKey].Data()), Equals, testBlob)
+	c.Assert(results[partialKey].Cmd().ID.Group, Equals, s.groups[len(s.groups)-1])
+}
+
+func (s *SessionSuite) TestBulkWrite(c *C) {
+	var (
+		testBlob   = `MY_TEST_BLOB_WITH_DUMMY_DATA`
+		testPrefix = fmt.Sprintf("testkey-bulk-write-%d", time.Now().Unix())
+	)
+
+	s.session.SetGroups(s.groups)
+
+	data := make(map[string][]byte)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("%s-%d", testPrefix, i)
+		data[key] = []byte(key + testBlob)
+	}
+
+	written := 0
+	for res := range s.session.BulkWrite(data, BulkWriteOptions{InFlight: 8, MaxBytes: 1024}) {
+		c.Assert(res.Err, IsNil)
+		c.Assert(res.Groups, HasLen, len(s.groups))
+		_, ok := data[res.Key]
+		c.Assert(ok, Equals, true)
+		written++
+	}
+	c.Assert(written, Equals, len(data))
+
+	for key, d := range data {
+		for rd := range s.session.ReadData(key, 0, 0) {
+			c.Assert(rd.Error(), IsNil)
+			c.Assert(rd.Data(), DeepEquals, d)
+		}
+	}
+}
+
+func (s *SessionSuite) TestRetryPolicy(c *C) {
+	var (
+		testKey      = fmt.Sprintf("testkey-retry-%d", time.Now().Unix())
+		missingGroup = uint32(0xffff)
+	)
+
+	policy := &RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     10 * time.Millisecond,
+		MaxBackoff:  15 * time.Millisecond,
+	}
+	c.Assert(policy.backoff(1), Equals, 10*time.Millisecond)
+	c.Assert(policy.backoff(3), Equals, 15*time.Millisecond)
+	c.Assert(policy.shouldRetry([]error{ErrTimeout, ErrNotFound}), Equals, true)
+	c.Assert(policy.shouldRetry([]error{ErrTimeout, nil}), Equals, false)
+	c.Assert(policy.shouldRetry([]error{ErrNotFound}), Equals, false)
+
+	s.session.SetGroups(s.groups)
+	s.session.SetRetryPolicy(policy)
+	defer s.session.SetRetryPolicy(nil)
+
+	// there are no nodes in the group, every attempt fails with -ENXIO
+	ctx := context.Background()
+	for rd := range s.session.ReadDataCtx(ctx, testKey, 0, 0, WithGroups(missingGroup)) {
+		c.Assert(rd.Error(), NotNil)
+		c.Assert(Attempts(rd), Equals, policy.MaxAttempts)
+	}
+
+	// writes are not retried unless policy allows it
+	for wr := range s.session.WriteDataCtx(ctx, testKey, strings.NewReader(testKey), 0, 0, WithGroups(missingGroup)) {
+		c.Assert(wr.Error(), NotNil)
+		c.Assert(Attempts(wr), Equals, 1)
+	}
+
+	retryWrites := WithRetry(&RetryPolicy{
+		MaxAttempts: 2,
+		RetryWrites: true,
+	})
+	for wr := range s.session.WriteDataCtx(ctx, testKey, strings.NewReader(testKey), 0, 0,
+		WithGroups(missingGroup), retryWrites) {
+		c.Assert(wr.Error(), NotNil)
+		c.Assert(Attempts(wr), Equals, 2)
+	}
+}
+
+func (s *SessionSuite) TestCircuitBreakerDefaultFilter(c *C) {
+	var (
+		testBlob     = `MY_TEST_BLOB_WITH_DUMMY_DATA`
+		testKey      = fmt.Sprintf("testkey-breaker-%d", time.Now().Unix())
+		missingGroup = uint32(0xffff)
+	)
+
+	// session keeps default filter, negative replies are never passed to the caller
+	cb := NewCircuitBreaker(BreakerConfig{
+		Failures:    2,
+		OpenTimeout: time.Minute,
+	})
+	s.session.SetGroups(append(append([]uint32{}, s.groups...), missingGroup))
+	s.session.SetCircuitBreaker(cb)
+
+	for i := 0; i < 2; i++ {
+		for wr := range s.session.WriteData(testKey, strings.NewReader(testBlob), 0, 0) {
+			c.Assert(wr.Error(), IsNil)
+			c.Assert(wr.Cmd().ID.Group, Not(Equals), missingGroup)
+		}
+	}
+
+	// group without nodes fails with -ENXIO, the breaker sees it although the caller does not
+	c.Assert(cb.Group(missingGroup).State, Equals, BreakerOpen)
+	for _, group := range s.groups {
+		c.Check(cb.Group(group).State, Equals, BreakerClosed)
+	}
+
+	// open breaker drops the missing group, data is read from the first group which has it
+	replied := make([]uint32, 0, len(s.groups))
+	for rd := range s.session.ReadData(testKey, 0, 0) {
+		c.Assert(rd.Error(), IsNil)
+		c.Assert(rd.Data(), DeepEquals, []byte(testBlob))
+		replied = append(replied, rd.Cmd().ID.Group)
+	}
+	c.Assert(replied, HasLen, 1)
+}
+
+func (s *SessionSuite) TestGroupSelector(c *C) {
+	const key = "group selector key"
+
+	s.session.SetGroups(s.groups)
+
+	selector := NewGroupSelector(s.session)
+	c.Assert(selector.Candidates(key, 1), HasLen, 0)
+
+	stat := s.session.DnetStat()
+	selector.Update(stat)
+
+	candidates := selector.Candidates(key, 1)
+	c.Assert(candidates, HasLen, len(s.groups))
+	for i := 1; i < len(candidates); i++ {
+		c.Check(candidates[i-1].Free >= candidates[i].Free, Equals, true)
+	}
+
+	// read-only backend must not be selected
+	candidates[0].Backend.RO = true
+	groups, err := selector.Select(key, 1, len(s.groups)-1)
+	c.Assert(err, IsNil)
+	c.Assert(groups, HasLen, len(s.groups)-1)
+	for _, group := range groups {
+		c.Check(group, Not(Equals), candidates[0].Group)
+	}
+
+	_, err = selector.Select(key, 1, len(s.groups))
+	c.Assert(errors.Is(err, ErrNoSpace), Equals, true)
+}
+
+func (s *SessionSuite) TestPIDFeedback(c *C) {
+	const key = "pid feedback key"
+
+	s.session.SetGroups(s.groups)
+
+	feedback := NewPIDFeedback(0)
+	s.session.SetPIDFeedback(feedback)
+
+	selector := NewGroupSelector(s.session)
+	selector.Feedback = feedback
+	selector.Update(s.session.DnetStat())
+
+	// speed of small writes is dominated by latency, they do not affect pain
+	var addrs []DnetAddr
+	var abs []AddressBackend
+	for l := range s.session.WriteData(key, strings.NewReader("some data"), 0, 0) {
+		c.Assert(l.Error(), IsNil)
+		addrs = append(addrs, *l.Addr())
+		abs = append(abs, NewAddressBackend(l.Addr(), l.Cmd().Backend))
+	}
+	c.Assert(abs, HasLen, len(s.groups))
+
+	for _, ab := range abs {
+		c.Check(feedback.Pain(ab), Equals, float64(0))
+	}
+
+	// large write which is slower than the target speed raises pain
+	for i, ab := range abs {
+		feedback.Observe(&addrs[i], ab.Backend, DefaultPIDMinWriteSize, time.Second)
+		c.Check(feedback.Pain(ab) > 0, Equals, true)
+	}
+
+	for _, candidate := range selector.Candidates(key, 0) {
+		c.Check(candidate.Pain, Equals, feedback.Pain(candidate.Backend.Ab))
+	}
+}
+
+func (s *SessionSuite) TestStatMonitor(c *C) {
+	selector := NewGroupSelector(s.session)
+	monitor := NewStatMonitor(s.session, 100*time.Millisecond, 2, selector.Update)
+
+	updates, unsubscribe := monitor.Subscribe(4)
+	defer unsubscribe()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case st := <-updates:
+			c.Assert(st.Group, HasLen, len(s.groups))
+		case <-time.After(5 * time.Second):
+			c.Fatalf("no statistics update, err: %v", monitor.Err())
+		}
+	}
+
+	monitor.Close()
+	for range updates {
+	}
+
+	history := monitor.History()
+	c.Assert(history, HasLen, 2)
+	c.Assert(history[0].Time.After(history[1].Time), Equals, false)
+	c.Assert(monitor.Latest(), Equals, history[1])
+	c.Assert(selector.Stat(), Equals, history[1])
+}
+
+func (s *SessionSuite) TestPrometheusHandler(c *C) {
+	var stat *DnetStat
+	handler := NewPrometheusHandler(func() *DnetStat {
+		return stat
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	c.Assert(rec.Code, Equals, http.StatusServiceUnavailable)
+
+	stat = s.session.DnetStat()
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	c.Assert(rec.Code, Equals, http.StatusOK)
+	c.Assert(rec.Header().Get("Content-Type"), Equals, PrometheusContentType)
+
+	body := rec.Body.String()
+	c.Assert(strings.Contains(body, "# TYPE elliptics_backend_vfs_total_bytes gauge\n"), Equals, true)
+	for _, group := range s.groups {
+		c.Check(strings.Contains(body, fmt.Sprintf("elliptics_backend_pid_pain{group=\"%d\",", group)), Equals, true)
+	}
+	c.Assert(strings.Contains(body, "elliptics_backend_command_bps{"), Equals, true)
+}
+
+func (s *SessionSuite) TestMemoryMetrics(c *C) {
+	const (
+		key  = "memory metrics key"
+		data = "some data"
+	)
+
+	s.session.SetGroups(s.groups)
+
+	metrics := NewMemoryMetrics(nil)
+	s.session.SetMetrics(metrics)
+
+	for l := range s.session.WriteData(key, strings.NewReader(data), 0, 0) {
+		c.Assert(l.Error(), IsNil)
+	}
+	for r := range s.session.ReadData(key, 0, 0) {
+		c.Assert(r.Error(), IsNil)
+	}
+	for r := range s.session.ReadData("memory metrics missing key", 0, 0) {
+		c.Assert(r.Error(), NotNil)
+	}
+
+	var written, read, missing uint64
+	for key, st := range metrics.Snapshot() {
+		// errors of the whole operation are not bound to any group
+		if key.Group != 0 {
+			c.Check(key.Addr, Not(Equals), "")
+		}
+		c.Check(st.Latency.Count, Equals, st.Codes[0]+st.Codes[ErrNotFound.Code])
+
+		switch key.Op {
+		case OpWrite:
+			written += st.BytesWritten
+		case OpRead:
+			read += st.BytesRead
+			missing += st.Codes[ErrNotFound.Code]
+		}
+	}
+
+	c.Assert(written, Equals, uint64(len(data)*len(s.groups)))
+	c.Assert(read, Equals, uint64(len(data)))
+	c.Assert(missing > 0, Equals, true)
+
+	var exported []map[string]interface{}
+	c.Assert(json.Unmarshal([]byte(metrics.String()), &exported), IsNil)
+	c.Assert(exported, HasLen, len(metrics.Snapshot()))
+}
+
+type testSpan struct {
+	op      string
+	trace   TraceID
+	replies []OperationEvent
+	ended   chan error
+}
+
+func (sp *testSpan) Reply(ev OperationEvent) {
+	sp.replies = append(sp.replies, ev)
+}
+
+func (sp *testSpan) End(err error) {
+	sp.ended <- err
+}
+
+type testTracer struct {
+	spans chan *testSpan
+}
+
+func (t *testTracer) StartSpan(ctx context.Context, op string, trace TraceID) Span {
+	sp := &testSpan{
+		op:    op,
+		trace: trace,
+		ended: make(chan error, 1),
+	}
+	t.spans <- sp
+	return sp
+}
+
+func (s *SessionSuite) TestTracing(c *C) {
+	s.session.SetGroups(s.groups)
+
+	tracer := &testTracer{spans: make(chan *testSpan, 16)}
+	s.session.SetTracing(&TracingOptions{
+		Tracer:     tracer,
+		SampleRate: 1,
+	})
+
+	trace := NewTraceID()
+	ctx := WithTraceID(context.Background(), trace)
+	c.Assert(TraceIDFromContext(ctx), Equals, trace)
+
+	for l := range s.session.WriteDataCtx(ctx, "tracing key", strings.NewReader("some data"), 0, 0) {
+		c.Assert(l.Error(), IsNil)
+	}
+
+	sp := <-tracer.spans
+	c.Assert(<-sp.ended, IsNil)
+	c.Assert(sp.op, Equals, OpWrite)
+	c.Assert(sp.trace, Equals, trace)
+	c.Assert(sp.replies, HasLen, len(s.groups))
+	for _, ev := range sp.replies {
+		c.Check(ev.Code(), Equals, 0)
+		c.Check(ev.Addr, NotNil)
+	}
+
+	// sampled request is sent with trace bit and trace id of the context
+	session, release, err := s.session.contextSession(ctx, nil)
+	c.Assert(err, IsNil)
+	c.Assert(session, Not(Equals), s.session)
+	c.Check(session.GetCflags()&DNET_FLAGS_TRACE_BIT, Equals, DNET_FLAGS_TRACE_BIT)
+	c.Check(session.GetTraceID(), Equals, trace)
+	release()
+	c.Assert(s.session.GetCflags()&DNET_FLAGS_TRACE_BIT, Equals, Cflag(0))
+
+	// chunked write which fails before anything is sent starts no span
+	for l := range s.session.WriteChunkCtx(ctx, "tracing key", strings.NewReader(""), 0, 1) {
+		c.Assert(l.Error(), NotNil)
+	}
+	c.Assert(tracer.spans, HasLen, 0)
+
+	half := &TracingOptions{SampleRate: 0.5}
+	c.Assert(half.sampled(TraceID(1)), Equals, true)
+	c.Assert(half.sampled(TraceID(math.MaxUint64)), Equals, false)
+	c.Assert(half.sampled(0), Equals, false)
+}
+
+func (s *SessionSuite) TestNodeStates(c *C) {
+	events, unsubscribe := s.node.ConnectionEvents(16)
+	defer unsubscribe()
+
+	const down = "127.0.0.1:1:2"
+	c.Assert(s.node.AddRemote(down), NotNil)
+
+	states, err := s.node.States()
+	c.Assert(err, IsNil)
+
+	groups := make(map[uint32]bool)
+	var failed *RemoteState
+	for i := range states {
+		st := &states[i]
+		if st.Connected {
+			c.Check(st.ConnectedAt.IsZero(), Equals, false)
+			for _, group := range st.Groups {
+				groups[group] = true
+			}
+		}
+		if st.Addr == down {
+			failed = st
+		}
+	}
+	c.Assert(groups, HasLen, len(s.groups))
+	c.Assert(failed, NotNil)
+	c.Assert(failed.Connected, Equals, false)
+	c.Assert(failed.LastError, NotNil)
+
+	addrs, err := resolveRemote("localhost:1025")
+	c.Assert(err, IsNil)
+	c.Assert(len(addrs) > 0, Equals, true)
+
+	// every connection is reported once when it is noticed
+	for len(events) > 0 {
+		ev := <-events
+		c.Check(ev.Type, Equals, RemoteConnected)
+	}
+	_, err = s.node.States()
+	c.Assert(err, IsNil)
+	c.Assert(events, HasLen, 0)
+}
+
+func (s *SessionSuite) TestHealthCheckReconnect(c *C) {
+	ioserv, err := StartDnetIOServ([]uint32{7})
+	c.Assert(err, IsNil)
+	defer ioserv.Close()
+
+	// server is down when the node starts
+	c.Assert(ioserv.Stop(), IsNil)
+	remote := ioserv.Address()[0]
+
+	node, err := NewNodeLogger(nil, "error", nil)
+	c.Assert(err, IsNil)
+	defer node.Free()
+
+	c.Assert(node.AddRemote(remote), NotNil)
+
+	events, unsubscribe := node.ConnectionEvents(16)
+	defer unsubscribe()
+
+	node.StartHealthCheck(100 * time.Millisecond)
+	c.Assert(ioserv.Start(), IsNil)
+
+	select {
+	case ev := <-events:
+		c.Assert(ev.Type, Equals, RemoteConnected)
+		c.Assert(ev.Remote, Equals, remote)
+	case <-time.After(10 * time.Second):
+		c.Fatal("remote has not been reconnected by the health check")
+	}
+	node.StopHealthCheck()
+
+	// hostname remote is reported once, by the address it has been resolved into
+	states, err := node.States()
+	c.Assert(err, IsNil)
+	c.Assert(states, HasLen, 1)
+	c.Assert(states[0].Remote, Equals, remote)
+	c.Assert(states[0].Addr, Not(Equals), remote)
+	c.Assert(states[0].Connected, Equals, true)
+	c.Assert(states[0].Groups, DeepEquals, []uint32{7})
+}
+
+func (s *SessionSuite) TestRouteTable(c *C) {
+	s.session.SetGroups(s.groups)
+
+	table := s.session.RouteTable()
+	c.Assert(table.Groups(), DeepEquals, s.groups)
+
+	key := fmt.Sprintf("route-key-%d", time.Now().UnixNano())
+	id, err := s.session.KeyID(key)
+	c.Assert(err, IsNil)
+
+	for _, group := range s.groups {
+		entry := table.Lookup(group, id)
+		c.Assert(entry, NotNil)
+
+		addr, backend, err := s.session.LookupBackend(key, group)
+		c.Assert(err, IsNil)
+		c.Check(entry.AddressBackend(), Equals, NewAddressBackend(addr, backend))
+
+		covered := false
+		for _, r := range table.Ranges(group, entry.AddressBackend()) {
+			covered = covered || r.Contains(id)
+		}
+		c.Check(covered, Equals, true)
+	}
+	c.Assert(table.Diff(s.session.RouteTable()), HasLen, 0)
+
+	// synthetic ring: a backend joins between two others and takes part of the range of the first one
+	addr := DnetAddr{Addr: []byte{127, 0, 0, 1, 0, 0, 0, 0}, Family: 2}
+	entry := func(id byte, backend int32) *RouteEntry {
+		return &RouteEntry{id: []byte{id}, addr: addr, group: 1, backend: backend}
+	}
+	prev := NewRouteTable([]*RouteEntry{entry(0x10, 1), entry(0x80, 2)})
+	next := NewRouteTable([]*RouteEntry{entry(0x10, 1), entry(0x40, 3), entry(0x80, 2)})
+
+	c.Assert(prev.Lookup(1, []byte{0x05}).backend, Equals, int32(2))
+	c.Assert(next.Lookup(1, []byte{0x50}).backend, Equals, int32(3))
+
+	events := next.Diff(prev)
+	c.Assert(events, HasLen, 2)
+	c.Check(events[0].Type, Equals, RouteMove)
+	c.Check(events[0].Backend.Backend, Equals, int32(1))
+	c.Check(events[1].Type, Equals, RouteJoin)
+	c.Check(events[1].Backend.Backend, Equals, int32(3))
+
+	events = prev.Diff(next)
+	c.Assert(events, HasLen, 2)
+	c.Check(events[0].Type, Equals, RouteLeave)
+	c.Check(events[0].Backend.Backend, Equals, int32(3))
+
+	watcher := NewRouteWatcher(s.session, time.Hour)
+	watcher.Close()
+	c.Assert(watcher.Latest(), NotNil)
+}
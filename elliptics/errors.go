@@ -22,7 +22,26 @@ package elliptics
 import "C"
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+)
+
+// Sentinel errors for the most common elliptics error codes, every DnetError with the same code
+// matches them with errors.Is(), and ErrorCode() of a sentinel returns its code:
+//
+//	if errors.Is(err, elliptics.ErrNotFound) {
+//		...
+//	}
+var (
+	ErrNotFound    = &DnetError{Code: -2, Message: "not found"}           // -ENOENT
+	ErrNoGroups    = &DnetError{Code: -6, Message: "no groups available"} // -ENXIO
+	ErrExists      = &DnetError{Code: -17, Message: "already exists"}     // -EEXIST
+	ErrInvalid     = &DnetError{Code: -22, Message: "invalid argument"}   // -EINVAL
+	ErrNoSpace     = &DnetError{Code: -28, Message: "no space left"}      // -ENOSPC
+	ErrReadOnly    = &DnetError{Code: -30, Message: "read-only backend"}  // -EROFS
+	ErrCASConflict = &DnetError{Code: -77, Message: "CAS conflict"}       // -EBADFD
+	ErrTimeout     = &DnetError{Code: -110, Message: "timed out"}         // -ETIMEDOUT
 )
 
 type DnetError struct {
@@ -35,8 +54,179 @@ func (err *DnetError) Error() string {
 	return fmt.Sprintf("elliptics error: %d: %s", err.Code, err.Message)
 }
 
+// Is reports whether @target is DnetError (in particular, a sentinel error) with the same code.
+func (err *DnetError) Is(target error) bool {
+	t, ok := target.(*DnetError)
+	return ok && t.Code == err.Code
+}
+
+// CASConflictError is returned by compare-and-swap writes when the stored record
+// does not match expected checksum or timestamp. It matches ErrCASConflict.
+type CASConflictError struct {
+	DnetError
+
+	// group where the conflict has been detected
+	Group uint32
+}
+
+func (err *CASConflictError) Error() string {
+	return fmt.Sprintf("elliptics CAS conflict in group %d: %d: %s", err.Group, err.Code, err.Message)
+}
+
+func (err *CASConflictError) Unwrap() error {
+	return &err.DnetError
+}
+
+// PartialCASConflictError is returned by ReadModifyWrite when CAS conflict has been detected in some groups only,
+// groups which have accepted the write already store the new data. It matches ErrCASConflict.
+type PartialCASConflictError struct {
+	// Accepted are groups which have accepted the write
+	Accepted []uint32
+
+	// Err holds failures of other groups
+	Err *MultiError
+}
+
+func (err *PartialCASConflictError) Error() string {
+	return fmt.Sprintf("partial CAS conflict, groups %v have accepted the write: %v", err.Accepted, err.Err)
+}
+
+func (err *PartialCASConflictError) Unwrap() error {
+	return err.Err
+}
+
+func IsCASConflict(err error) bool {
+	var ce *CASConflictError
+	return errors.As(err, &ce)
+}
+
+// GroupError is a failure of the operation in one group.
+type GroupError struct {
+	// Group is zero for the error of the whole operation
+	Group   uint32
+	Addr    DnetAddr
+	Backend int32
+	Err     error
+}
+
+func (err *GroupError) Error() string {
+	if err.Group == 0 {
+		return err.Err.Error()
+	}
+
+	return fmt.Sprintf("group %d, %s/%d: %v", err.Group, err.Addr.String(), err.Backend, err.Err)
+}
+
+func (err *GroupError) Unwrap() error {
+	return err.Err
+}
+
+// MultiError gathers per-group failures of one operation.
+//
+// Unwrap() and ErrorCode() use the most relevant failure: the first one which is neither
+// -ENOENT nor -ETIMEDOUT, otherwise -ETIMEDOUT if any group timed out, otherwise -ENOENT.
+// errors.Is() matches the most relevant failure only, so it always agrees with ErrorCode().
+// errors.As() prefers the most relevant failure and falls back to the first matching one.
+type MultiError struct {
+	Errors []*GroupError
+}
+
+func (err *MultiError) add(group uint32, addr *DnetAddr, backend int32, e error) {
+	ge := &GroupError{
+		Group:   group,
+		Backend: backend,
+		Err:     e,
+	}
+	if addr != nil {
+		ge.Addr = *addr
+	}
+
+	err.Errors = append(err.Errors, ge)
+}
+
+func (err *MultiError) errs() []error {
+	ret := make([]error, 0, len(err.Errors))
+	for _, ge := range err.Errors {
+		ret = append(ret, ge.Err)
+	}
+
+	return ret
+}
+
+// failure returns error of the operation which has not succeeded in any group:
+// MultiError itself or an error saying that there were no replies at all.
+func (err *MultiError) failure() error {
+	if len(err.Errors) == 0 {
+		return selectError(nil)
+	}
+
+	return err
+}
+
+func (err *MultiError) Error() string {
+	msgs := make([]string, 0, len(err.Errors))
+	for _, ge := range err.Errors {
+		msgs = append(msgs, ge.Error())
+	}
+
+	return fmt.Sprintf("elliptics: %d failures: %s", len(err.Errors), strings.Join(msgs, "; "))
+}
+
+func (err *MultiError) Unwrap() error {
+	return selectError(err.errs())
+}
+
+func (err *MultiError) As(target interface{}) bool {
+	if errors.As(err.Unwrap(), target) {
+		return true
+	}
+
+	for _, ge := range err.Errors {
+		if errors.As(ge, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// selectError picks the most relevant error among failed replies according to the rules described in MultiError.
+func selectError(errs []error) error {
+	if len(errs) == 0 {
+		return &DnetError{
+			Code:    ErrNoGroups.Code,
+			Flags:   0,
+			Message: "no replies received",
+		}
+	}
+
+	var timeout, noent error
+	for _, err := range errs {
+		switch {
+		case errors.Is(err, ErrTimeout):
+			if timeout == nil {
+				timeout = err
+			}
+		case errors.Is(err, ErrNotFound):
+			if noent == nil {
+				noent = err
+			}
+		default:
+			return err
+		}
+	}
+
+	if timeout != nil {
+		return timeout
+	}
+
+	return noent
+}
+
+// DnetErrorFromError returns DnetError found in the chain of @err or nil.
 func DnetErrorFromError(err error) *DnetError {
-	if ke, ok := err.(*DnetError); ok {
+	var ke *DnetError
+	if errors.As(err, &ke) {
 		return ke
 	}
 
@@ -44,7 +234,7 @@ func DnetErrorFromError(err error) *DnetError {
 }
 
 func ErrorData(err error) string {
-	if ke, ok := err.(*DnetError); ok {
+	if ke := DnetErrorFromError(err); ke != nil {
 		return ke.Message
 	}
 
@@ -52,9 +242,9 @@ func ErrorData(err error) string {
 }
 
 func ErrorCode(err error) int {
-	if ke, ok := err.(*DnetError); ok {
+	if ke := DnetErrorFromError(err); ke != nil {
 		return ke.Code
 	}
 
-	return -22 // -EINVAL
+	return ErrInvalid.Code
 }
@@ -32,3 +32,38 @@ func (s *ErrorSuite) TestDnetError(c *C) {
 	c.Assert(ErrorCode(dnetError), Equals, dnetError.Code)
 	c.Assert(ErrorCode(dummyError), Equals, -22)
 }
+
+func (s *ErrorSuite) TestSentinelErrors(c *C) {
+	var (
+		noent   = &DnetError{Code: -2, Message: "no such file"}
+		timeout = &DnetError{Code: -110, Message: "timed out"}
+		cas     = &CASConflictError{DnetError: DnetError{Code: -77}, Group: 1}
+	)
+
+	c.Assert(errors.Is(noent, ErrNotFound), Equals, true)
+	c.Assert(errors.Is(noent, ErrTimeout), Equals, false)
+	c.Assert(errors.Is(cas, ErrCASConflict), Equals, true)
+	c.Assert(ErrorCode(cas), Equals, -77)
+	c.Assert(ErrorCode(ErrNoSpace), Equals, -28)
+
+	multi := &MultiError{}
+	multi.add(1, nil, 0, noent)
+	multi.add(2, nil, 0, timeout)
+
+	// only the most relevant failure matches, a timed out group may still have the object
+	c.Assert(errors.Is(multi, ErrTimeout), Equals, true)
+	c.Assert(errors.Is(multi, ErrNotFound), Equals, false)
+	c.Assert(errors.Is(multi, ErrReadOnly), Equals, false)
+	c.Assert(ErrorCode(multi), Equals, -110)
+	c.Assert(DnetErrorFromError(multi), Equals, timeout)
+
+	var ge *GroupError
+	c.Assert(errors.As(multi, &ge), Equals, true)
+	c.Assert(ge.Group, Equals, uint32(1))
+
+	missing := &MultiError{}
+	missing.add(1, nil, 0, noent)
+	missing.add(2, nil, 0, noent)
+	c.Assert(errors.Is(missing, ErrNotFound), Equals, true)
+	c.Assert(ErrorCode(missing), Equals, -2)
+}
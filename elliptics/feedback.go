@@ -0,0 +1,148 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPIDTargetSpeed is the write speed in bytes per second backends are expected to achieve
+	DefaultPIDTargetSpeed float64 = 100 * 1024 * 1024
+
+	// DefaultPIDMinWriteSize is the size of the smallest write whose speed is fed into controllers
+	DefaultPIDMinWriteSize uint64 = 1024 * 1024
+
+	// PID error is measured in megabytes per second to keep pain values readable
+	pidErrorUnit float64 = 1024 * 1024
+)
+
+/*
+PIDFeedback feeds PID controllers of backends with write speed observed by the sessions it is set on.
+
+Every successful write reply (Lookuper) names address and backend which has stored the data,
+speed of the write is compared with the target speed and the difference is fed into the controller
+of that AddressBackend: backends slower than the target get higher pain, faster ones get lower.
+Writes smaller than MinSize are ignored: their time is dominated by request latency, so their speed
+is always far below the target and says nothing about the backend.
+
+Controllers live in PIDFeedback and are shared with statistics snapshots passed to Apply(),
+so that PIDPain() of every new DnetStat reflects all writes observed so far.
+PIDFeedback is safe for concurrent use.
+*/
+type PIDFeedback struct {
+	// target write speed in bytes per second
+	target float64
+
+	// MinSize is the size of the smallest write which is observed, it must be set before
+	// the feedback is used. NewPIDFeedback() sets it to DefaultPIDMinWriteSize.
+	MinSize uint64
+
+	mutex sync.Mutex
+	pids  map[AddressBackend]*PID
+}
+
+// NewPIDFeedback returns feedback which compares write speed with @target bytes per second,
+// DefaultPIDTargetSpeed is used if @target is not positive.
+func NewPIDFeedback(target float64) *PIDFeedback {
+	if target <= 0 {
+		target = DefaultPIDTargetSpeed
+	}
+
+	return &PIDFeedback{
+		target:  target,
+		MinSize: DefaultPIDMinWriteSize,
+		pids:    make(map[AddressBackend]*PID),
+	}
+}
+
+func (f *PIDFeedback) pid(ab AddressBackend) *PID {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	p, ok := f.pids[ab]
+	if !ok {
+		p = NewPIDController()
+		f.pids[ab] = p
+	}
+
+	return p
+}
+
+// Observe updates controller of @addr/@backend with the speed of the write of @size bytes which took @d.
+// Writes smaller than MinSize are ignored.
+func (f *PIDFeedback) Observe(addr *DnetAddr, backend int32, size uint64, d time.Duration) {
+	if size == 0 || size < f.MinSize || d <= 0 || len(addr.Addr) == 0 {
+		return
+	}
+
+	speed := float64(size) / d.Seconds()
+	f.pid(NewAddressBackend(addr, backend)).Update((f.target - speed) / pidErrorUnit)
+}
+
+// observeWrite reports successful write reply to the feedback.
+func (f *PIDFeedback) observeWrite(lookup Lookuper, size uint64, start time.Time) {
+	if lookup.Error() != nil {
+		return
+	}
+
+	f.Observe(lookup.Addr(), lookup.Cmd().Backend, size, time.Since(start))
+}
+
+// Apply makes backends of @stat share controllers with the feedback.
+// Backends which have not been written to yet keep their controllers, which become tracked by the feedback,
+// thus state carried over by DnetStat.Diff() is preserved. Apply should be called after Diff().
+func (f *PIDFeedback) Apply(stat *DnetStat) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, sg := range stat.Group {
+		for ab, sb := range sg.Ab {
+			if p, ok := f.pids[ab]; ok {
+				sb.PID = p
+			} else {
+				f.pids[ab] = sb.PID
+			}
+		}
+	}
+}
+
+// Pain returns current pain of @ab, zero if nothing has been observed for it.
+func (f *PIDFeedback) Pain(ab AddressBackend) float64 {
+	f.mutex.Lock()
+	p, ok := f.pids[ab]
+	f.mutex.Unlock()
+
+	if !ok {
+		return 0
+	}
+
+	p.RLock()
+	defer p.RUnlock()
+
+	return p.Pain
+}
+
+// SetPIDFeedback sets feedback which is fed with speed of the session writes, nil disables it.
+// Cloned sessions share the feedback.
+func (s *Session) SetPIDFeedback(f *PIDFeedback) {
+	s.feedback = f
+}
+
+func (s *Session) GetPIDFeedback() *PIDFeedback {
+	return s.feedback
+}
@@ -19,6 +19,11 @@ package elliptics
 //#include <elliptics/interface.h>
 import "C"
 
+import (
+	"fmt"
+	"strings"
+)
+
 type IOflag uint32
 
 const (
@@ -57,3 +62,71 @@ const (
 )
 
 type TraceID C.trace_id_t
+
+// IOflagNames maps IO flag names without DNET_IO_FLAGS_ prefix to flags, see ParseIOflags.
+var IOflagNames = map[string]IOflag{
+	"SKIP_SENDING":           DNET_IO_FLAGS_SKIP_SENDING,
+	"MIX_STATES":             DNET_IO_FLAGS_MIX_STATES,
+	"APPEND":                 DNET_IO_FLAGS_APPEND,
+	"PREPARE":                DNET_IO_FLAGS_PREPARE,
+	"COMMIT":                 DNET_IO_FLAGS_COMMIT,
+	"REMOVED":                DNET_IO_FLAGS_REMOVED,
+	"OVERWRITE":              DNET_IO_FLAGS_OVERWRITE,
+	"NOCSUM":                 DNET_IO_FLAGS_NOCSUM,
+	"PLAIN_WRITE":            DNET_IO_FLAGS_PLAIN_WRITE,
+	"NODATA":                 DNET_IO_FLAGS_NODATA,
+	"CACHE":                  DNET_IO_FLAGS_CACHE,
+	"CACHE_ONLY":             DNET_IO_FLAGS_CACHE_ONLY,
+	"CACHE_REMOVE_FROM_DISK": DNET_IO_FLAGS_CACHE_REMOVE_FROM_DISK,
+	"COMPARE_AND_SWAP":       DNET_IO_FLAGS_COMPARE_AND_SWAP,
+	"CHECKSUM":               DNET_IO_FLAGS_CHECKSUM,
+	"WRITE_NO_FILE_INFO":     DNET_IO_FLAGS_WRITE_NO_FILE_INFO,
+	"CAS_TIMESTAMP":          DNET_IO_FLAGS_CAS_TIMESTAMP,
+}
+
+// CflagNames maps command flag names without DNET_FLAGS_ prefix to flags, see ParseCflags.
+var CflagNames = map[string]Cflag{
+	"NEED_ACK":       DNET_FLAGS_NEED_ACK,
+	"MORE":           DNET_FLAGS_MORE,
+	"DESTROY":        DNET_FLAGS_DESTROY,
+	"DIRECT":         DNET_FLAGS_DIRECT,
+	"NOLOCK":         DNET_FLAGS_NOLOCK,
+	"CHECKSUM":       DNET_FLAGS_CHECKSUM,
+	"NOCACHE":        DNET_FLAGS_NOCACHE,
+	"DIRECT_BACKEND": DNET_FLAGS_DIRECT_BACKEND,
+	"TRACE_BIT":      DNET_FLAGS_TRACE_BIT,
+	"REPLY":          DNET_FLAGS_REPLY,
+}
+
+// flagName normalizes flag name: "nocsum", "NOCSUM" and "DNET_IO_FLAGS_NOCSUM" are the same flag.
+func flagName(name, prefix string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), prefix)
+}
+
+// ParseIOflags returns IO flags combined from their names, name may omit DNET_IO_FLAGS_ prefix and is case-insensitive.
+func ParseIOflags(names []string) (IOflag, error) {
+	var flags IOflag
+	for _, name := range names {
+		flag, ok := IOflagNames[flagName(name, "DNET_IO_FLAGS_")]
+		if !ok {
+			return 0, fmt.Errorf("unknown IO flag: %s", name)
+		}
+		flags |= flag
+	}
+
+	return flags, nil
+}
+
+// ParseCflags returns command flags combined from their names, name may omit DNET_FLAGS_ prefix and is case-insensitive.
+func ParseCflags(names []string) (Cflag, error) {
+	var flags Cflag
+	for _, name := range names {
+		flag, ok := CflagNames[flagName(name, "DNET_FLAGS_")]
+		if !ok {
+			return 0, fmt.Errorf("unknown command flag: %s", name)
+		}
+		flags |= flag
+	}
+
+	return flags, nil
+}
@@ -0,0 +1,172 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"context"
+	"time"
+)
+
+// HedgeOptions controls GetHedged.
+type HedgeOptions struct {
+	// Delay is the time to wait for reply from one group before the read is sent to the next one.
+	// Zero delay sends the read to all groups at once.
+	Delay time.Duration
+
+	// Percentile (for example 0.95) of latency of the group being read, when set and known,
+	// is used instead of Delay
+	Percentile float64
+}
+
+type hedgeReply struct {
+	data []byte
+	info ObjectInfo
+	err  error
+}
+
+func (c *Client) hedgeDelay(group uint32, opts *HedgeOptions) time.Duration {
+	if opts.Percentile > 0 {
+		if d, ok := c.latency.Percentile(group, opts.Percentile); ok {
+			return d
+		}
+	}
+
+	return opts.Delay
+}
+
+// readGroup reads the whole object from @group only and records latency of the reply.
+// If the read is cancelled before any reply, time spent so far is recorded as a lower bound of the latency.
+func (c *Client) readGroup(ctx context.Context, key string, group uint32, replies chan<- hedgeReply,
+	options []CallOption) {
+	options = withOptions(options, WithGroups(group))
+
+	reply := hedgeReply{}
+	errs := &MultiError{}
+	found := false
+	replied := false
+	started := time.Now()
+
+	for rd := range c.session.ReadDataCtx(ctx, key, 0, 0, options...) {
+		if err := rd.Error(); err != nil {
+			errs.add(rd.Cmd().ID.Group, rd.Addr(), rd.Cmd().Backend, err)
+
+			// overall operation error has no server reply attached
+			if rd.Cmd().ID.Group != 0 {
+				c.latency.Observe(group, rd.Addr(), time.Since(started))
+				replied = true
+			}
+			continue
+		}
+
+		c.latency.Observe(group, rd.Addr(), time.Since(started))
+		replied = true
+		if !found {
+			reply.data = rd.Data()
+			reply.info = newObjectInfoRead(rd)
+			found = true
+		}
+	}
+
+	// read has been cancelled because another group has won
+	if !replied && ctx.Err() != nil {
+		c.latency.ObserveLowerBound(group, time.Since(started))
+	}
+
+	if !found {
+		reply.err = errs.failure()
+	}
+
+	replies <- reply
+}
+
+// GetHedged reads the whole object from the group with the lowest observed latency.
+// If there is no reply within the delay described by @opts, the read is also sent to the next group and so on.
+// The first successful reply is returned and other reads are cancelled.
+func (c *Client) GetHedged(key string, opts HedgeOptions) ([]byte, ObjectInfo, error) {
+	return c.GetHedgedCtx(context.Background(), key, opts)
+}
+
+// GetHedgedCtx is a GetHedged which gives up when @ctx is done.
+func (c *Client) GetHedgedCtx(ctx context.Context, key string, opts HedgeOptions,
+	options ...CallOption) ([]byte, ObjectInfo, error) {
+	groups := c.session.GetGroups()
+	if callOpts := callOptions(options); callOpts != nil && len(callOpts.Groups) != 0 {
+		groups = callOpts.Groups
+	}
+	if len(groups) == 0 {
+		return nil, ObjectInfo{}, selectError(nil)
+	}
+	groups = c.latency.Order(groups)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	replies := make(chan hedgeReply, len(groups))
+	next, pending := 0, 0
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	launch := func() {
+		group := groups[next]
+		next++
+		pending++
+
+		go c.readGroup(ctx, key, group, replies, options)
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if next < len(groups) {
+			timer.Reset(c.hedgeDelay(group, &opts))
+		}
+	}
+
+	errs := &MultiError{}
+
+	launch()
+	for {
+		select {
+		case reply := <-replies:
+			pending--
+			if reply.err == nil {
+				return reply.data, reply.info, nil
+			}
+
+			if m, ok := reply.err.(*MultiError); ok {
+				errs.Errors = append(errs.Errors, m.Errors...)
+			} else {
+				errs.add(0, nil, 0, reply.err)
+			}
+			if ctx.Err() != nil {
+				return nil, ObjectInfo{}, ctx.Err()
+			}
+
+			if next < len(groups) {
+				launch()
+			} else if pending == 0 {
+				return nil, ObjectInfo{}, errs.failure()
+			}
+		case <-timer.C:
+			if next < len(groups) {
+				launch()
+			}
+		}
+	}
+}
@@ -0,0 +1,484 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+/*
+#include "session.h"
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"context"
+	"unsafe"
+)
+
+/*
+   Secondary indexes
+*/
+
+// Indexer wraps one result of set, update and remove indexes operations.
+type Indexer interface {
+	// server's reply
+	Cmd() *DnetCmd
+
+	// server's address
+	Addr() *DnetAddr
+
+	//Error of the operation.
+	Error() error
+}
+
+type indexResult struct {
+	cmd  DnetCmd
+	addr DnetAddr
+	err  error
+}
+
+func (i *indexResult) Cmd() *DnetCmd {
+	return &i.cmd
+}
+func (i *indexResult) Addr() *DnetAddr {
+	return &i.addr
+}
+func (i *indexResult) Error() error {
+	return i.err
+}
+
+// IndexEntry is data attached to the key in the index with ID @Index.
+type IndexEntry struct {
+	Index DnetRawID
+	Data  []byte
+}
+
+// Finder wraps one key found by FindAllIndexes and FindAnyIndexes operations.
+type Finder interface {
+	// ID of the found key
+	ID() *DnetRawID
+
+	// data attached to the key in every matched index
+	Entries() []IndexEntry
+
+	Error() error
+}
+
+type findResult struct {
+	id      DnetRawID
+	entries []IndexEntry
+	err     error
+}
+
+func (f *findResult) ID() *DnetRawID {
+	return &f.id
+}
+func (f *findResult) Entries() []IndexEntry {
+	return f.entries
+}
+func (f *findResult) Error() error {
+	return f.err
+}
+
+// Lister wraps one index returned by ListIndexes operation.
+type Lister interface {
+	// index entry containing index ID and data attached to the key
+	Entry() *IndexEntry
+
+	Error() error
+}
+
+type listResult struct {
+	entry IndexEntry
+	err   error
+}
+
+func (l *listResult) Entry() *IndexEntry {
+	return &l.entry
+}
+func (l *listResult) Error() error {
+	return l.err
+}
+
+func newIndexEntry(entry *C.struct_go_index_entry) IndexEntry {
+	ret := IndexEntry{
+		Index: *NewDnetRawIDraw(entry.index),
+	}
+
+	if entry.size > 0 && entry.data != nil {
+		ret.Data = C.GoBytes(unsafe.Pointer(entry.data), C.int(entry.size))
+	} else {
+		ret.Data = make([]byte, 0)
+	}
+
+	return ret
+}
+
+//export go_index_error
+func go_index_error(cmd *C.struct_dnet_cmd, addr *C.struct_dnet_addr, cerr *C.struct_go_error, key uint64) {
+	context, err := Pool.Get(key)
+	if err == ContextCancelledError {
+		return
+	}
+	if err != nil {
+		panic("Unable to find index callback")
+	}
+	callback := context.(func(*indexResult))
+
+	callback(&indexResult{
+		cmd:  NewDnetCmd(cmd),
+		addr: NewDnetAddr(addr),
+		err: &DnetError{
+			Code:    int(cerr.code),
+			Flags:   uint64(cerr.flags),
+			Message: C.GoString(cerr.message),
+		},
+	})
+}
+
+//export go_index_callback
+func go_index_callback(result *C.struct_go_index_result, key uint64) {
+	context, err := Pool.Get(key)
+	if err == ContextCancelledError {
+		return
+	}
+	if err != nil {
+		panic("Unable to find index callback")
+	}
+	callback := context.(func(*indexResult))
+
+	callback(&indexResult{
+		cmd:  NewDnetCmd(result.cmd),
+		addr: NewDnetAddr(result.addr),
+	})
+}
+
+//export go_find_callback
+func go_find_callback(result *C.struct_go_find_result, key uint64) {
+	context, err := Pool.Get(key)
+	if err == ContextCancelledError {
+		return
+	}
+	if err != nil {
+		panic("Unable to find index callback")
+	}
+	callback := context.(func(*findResult))
+
+	res := &findResult{
+		id:      *NewDnetRawIDraw(result.id),
+		entries: make([]IndexEntry, 0, int(result.entries_count)),
+	}
+
+	if result.entries_count > 0 {
+		entries := (*[1 << 20]C.struct_go_index_entry)(unsafe.Pointer(result.entries))[:result.entries_count:result.entries_count]
+		for i := range entries {
+			res.entries = append(res.entries, newIndexEntry(&entries[i]))
+		}
+	}
+
+	callback(res)
+}
+
+//export go_list_callback
+func go_list_callback(entry *C.struct_go_index_entry, key uint64) {
+	context, err := Pool.Get(key)
+	if err == ContextCancelledError {
+		return
+	}
+	if err != nil {
+		panic("Unable to find index callback")
+	}
+	callback := context.(func(*listResult))
+
+	callback(&listResult{
+		entry: newIndexEntry(entry),
+	})
+}
+
+// cIndexes holds C copies of index names and data which are passed to C++ indexes calls.
+type cIndexes struct {
+	names []*C.char
+	data  []C.struct_go_data_pointer
+}
+
+func newCIndexes(names []string, data [][]byte) *cIndexes {
+	ci := &cIndexes{
+		names: make([]*C.char, 0, len(names)),
+		data:  make([]C.struct_go_data_pointer, 0, len(data)),
+	}
+
+	for _, name := range names {
+		ci.names = append(ci.names, C.CString(name))
+	}
+
+	for _, d := range data {
+		var cdata *C.char
+		if len(d) != 0 {
+			cdata = (*C.char)(C.CBytes(d))
+		}
+		ci.data = append(ci.data, C.new_data_pointer(cdata, C.int(len(d))))
+	}
+
+	return ci
+}
+
+func (ci *cIndexes) Free() {
+	for _, name := range ci.names {
+		C.free(unsafe.Pointer(name))
+	}
+	for _, d := range ci.data {
+		C.free(unsafe.Pointer(d.data))
+	}
+}
+
+func (ci *cIndexes) Names() **C.char {
+	if len(ci.names) == 0 {
+		return nil
+	}
+	return &ci.names[0]
+}
+
+func (ci *cIndexes) Data() *C.struct_go_data_pointer {
+	if len(ci.data) == 0 {
+		return nil
+	}
+	return &ci.data[0]
+}
+
+func (ci *cIndexes) Count() C.uint64_t {
+	return C.uint64_t(len(ci.names))
+}
+
+// indexCtx issues set/update/remove indexes request @call bound to @ctx and returns channel of its results.
+func (s *Session) indexCtx(ctx context.Context, opts *CallOptions, key string,
+	call func(session *Session, ekey *Key, onResultContext, onFinishContext uint64)) <-chan Indexer {
+	responseCh := make(chan Indexer, defaultVOLUME)
+
+	ekey, err := NewKey(key)
+	if err != nil {
+		responseCh <- &indexResult{err: err}
+		close(responseCh)
+		return responseCh
+	}
+	defer ekey.Free()
+
+	session, release, err := s.contextSession(ctx, opts)
+	if err != nil {
+		responseCh <- &indexResult{err: err}
+		close(responseCh)
+		return responseCh
+	}
+	defer release()
+
+	op := s.newOp(ctx, OpIndex, opts)
+
+	onResult := func(result *indexResult) {
+		op.Deliver(func() {
+			op.sendIndex(responseCh, result)
+		})
+	}
+
+	onFinish := func(err error) {
+		if err != nil {
+			op.sendIndex(responseCh, &indexResult{err: err})
+		}
+		close(responseCh)
+	}
+
+	onResultContext := op.Store(onResult)
+	onFinishContext := op.Finish(onFinish)
+
+	call(session, ekey, onResultContext, onFinishContext)
+	return responseCh
+}
+
+func splitIndexes(indexes map[string][]byte) ([]string, [][]byte) {
+	names := make([]string, 0, len(indexes))
+	data := make([][]byte, 0, len(indexes))
+	for name, d := range indexes {
+		names = append(names, name)
+		data = append(data, d)
+	}
+
+	return names, data
+}
+
+// SetIndexes replaces all indexes of the key with given ones.
+// @indexes maps index name into data which is attached to the key in that index.
+func (s *Session) SetIndexes(key string, indexes map[string][]byte) <-chan Indexer {
+	return s.SetIndexesCtx(context.Background(), key, indexes)
+}
+
+// SetIndexesCtx is a SetIndexes which is stopped when @ctx is done.
+func (s *Session) SetIndexesCtx(ctx context.Context, key string, indexes map[string][]byte,
+	options ...CallOption) <-chan Indexer {
+	return s.setOrUpdateIndexes(ctx, callOptions(options), indexesSet, key, indexes)
+}
+
+// UpdateIndexes adds the key to given indexes (or updates its data there), other indexes of the key are not touched.
+func (s *Session) UpdateIndexes(key string, indexes map[string][]byte) <-chan Indexer {
+	return s.UpdateIndexesCtx(context.Background(), key, indexes)
+}
+
+// UpdateIndexesCtx is an UpdateIndexes which is stopped when @ctx is done.
+func (s *Session) UpdateIndexesCtx(ctx context.Context, key string, indexes map[string][]byte,
+	options ...CallOption) <-chan Indexer {
+	return s.setOrUpdateIndexes(ctx, callOptions(options), indexesUpdate, key, indexes)
+}
+
+func (s *Session) setOrUpdateIndexes(ctx context.Context, opts *CallOptions, operation int, key string, indexes map[string][]byte) <-chan Indexer {
+	ci := newCIndexes(splitIndexes(indexes))
+	defer ci.Free()
+
+	return s.indexCtx(ctx, opts, key, func(session *Session, ekey *Key, onResultContext, onFinishContext uint64) {
+		switch operation {
+		case indexesSet:
+			C.session_set_indexes(session.session, C.context_t(onResultContext), C.context_t(onFinishContext),
+				ekey.key, ci.Names(), ci.Data(), ci.Count())
+		case indexesUpdate:
+			C.session_update_indexes(session.session, C.context_t(onResultContext), C.context_t(onFinishContext),
+				ekey.key, ci.Names(), ci.Data(), ci.Count())
+		}
+	})
+}
+
+// RemoveIndexes removes the key from given indexes.
+func (s *Session) RemoveIndexes(key string, indexes []string) <-chan Indexer {
+	return s.RemoveIndexesCtx(context.Background(), key, indexes)
+}
+
+// RemoveIndexesCtx is a RemoveIndexes which is stopped when @ctx is done.
+func (s *Session) RemoveIndexesCtx(ctx context.Context, key string, indexes []string, options ...CallOption) <-chan Indexer {
+	ci := newCIndexes(indexes, nil)
+	defer ci.Free()
+
+	return s.indexCtx(ctx, callOptions(options), key, func(session *Session, ekey *Key, onResultContext, onFinishContext uint64) {
+		C.session_remove_indexes(session.session, C.context_t(onResultContext), C.context_t(onFinishContext),
+			ekey.key, ci.Names(), ci.Count())
+	})
+}
+
+func (s *Session) findIndexes(ctx context.Context, opts *CallOptions, indexes []string, all bool) <-chan Finder {
+	responseCh := make(chan Finder, defaultVOLUME)
+
+	session, release, err := s.contextSession(ctx, opts)
+	if err != nil {
+		responseCh <- &findResult{err: err}
+		close(responseCh)
+		return responseCh
+	}
+	defer release()
+	s.keepFilter(session)
+
+	ci := newCIndexes(indexes, nil)
+	defer ci.Free()
+
+	op := s.newOp(ctx, OpFindIndexes, opts)
+
+	onResult := func(result *findResult) {
+		op.Deliver(func() {
+			op.sendFind(responseCh, result)
+		})
+	}
+
+	onFinish := func(err error) {
+		if err != nil {
+			op.sendFind(responseCh, &findResult{err: err})
+		}
+		close(responseCh)
+	}
+
+	onResultContext := op.Store(onResult)
+	onFinishContext := op.Finish(onFinish)
+
+	if all {
+		C.session_find_all_indexes(session.session, C.context_t(onResultContext), C.context_t(onFinishContext),
+			ci.Names(), ci.Count())
+	} else {
+		C.session_find_any_indexes(session.session, C.context_t(onResultContext), C.context_t(onFinishContext),
+			ci.Names(), ci.Count())
+	}
+
+	return responseCh
+}
+
+// FindAllIndexes returns keys which are present in every given index.
+func (s *Session) FindAllIndexes(indexes []string) <-chan Finder {
+	return s.FindAllIndexesCtx(context.Background(), indexes)
+}
+
+// FindAllIndexesCtx is a FindAllIndexes which is stopped when @ctx is done.
+func (s *Session) FindAllIndexesCtx(ctx context.Context, indexes []string, options ...CallOption) <-chan Finder {
+	return s.findIndexes(ctx, callOptions(options), indexes, true)
+}
+
+// FindAnyIndexes returns keys which are present in at least one of given indexes.
+func (s *Session) FindAnyIndexes(indexes []string) <-chan Finder {
+	return s.FindAnyIndexesCtx(context.Background(), indexes)
+}
+
+// FindAnyIndexesCtx is a FindAnyIndexes which is stopped when @ctx is done.
+func (s *Session) FindAnyIndexesCtx(ctx context.Context, indexes []string, options ...CallOption) <-chan Finder {
+	return s.findIndexes(ctx, callOptions(options), indexes, false)
+}
+
+// ListIndexes returns all indexes the key is present in.
+func (s *Session) ListIndexes(key string) <-chan Lister {
+	return s.ListIndexesCtx(context.Background(), key)
+}
+
+// ListIndexesCtx is a ListIndexes which is stopped when @ctx is done.
+func (s *Session) ListIndexesCtx(ctx context.Context, key string, options ...CallOption) <-chan Lister {
+	opts := callOptions(options)
+
+	responseCh := make(chan Lister, defaultVOLUME)
+
+	ekey, err := NewKey(key)
+	if err != nil {
+		responseCh <- &listResult{err: err}
+		close(responseCh)
+		return responseCh
+	}
+	defer ekey.Free()
+
+	session, release, err := s.contextSession(ctx, opts)
+	if err != nil {
+		responseCh <- &listResult{err: err}
+		close(responseCh)
+		return responseCh
+	}
+	defer release()
+	s.keepFilter(session)
+
+	op := s.newOp(ctx, OpListIndexes, opts)
+
+	onResult := func(result *listResult) {
+		op.Deliver(func() {
+			op.sendList(responseCh, result)
+		})
+	}
+
+	onFinish := func(err error) {
+		if err != nil {
+			op.sendList(responseCh, &listResult{err: err})
+		}
+		close(responseCh)
+	}
+
+	onResultContext := op.Store(onResult)
+	onFinishContext := op.Finish(onFinish)
+
+	C.session_list_indexes(session.session, C.context_t(onResultContext), C.context_t(onFinishContext), ekey.key)
+	return responseCh
+}
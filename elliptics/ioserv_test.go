@@ -115,6 +115,8 @@ type DnetIOServ struct {
 	cmd    *exec.Cmd
 	config *EllipticsServerConfig
 	base   string
+	file   string
+	port   int32
 }
 
 func StartDnetIOServ(groups []uint32) (*DnetIOServ, error) {
@@ -207,40 +209,63 @@ func StartDnetIOServ(groups []uint32) (*DnetIOServ, error) {
 		return nil, fmt.Errorf("Could not save config: %v", err)
 	}
 
-	ioservCmd := exec.Command("dnet_ioserv", "-c", file)
-	if err = ioservCmd.Start(); err != nil {
-		return nil, fmt.Errorf("Could not start dnet_ioserv process: %v\n", err)
+	d := &DnetIOServ{
+		config: config,
+		base:   base,
+		file:   file,
+		port:   port,
+	}
+	if err = d.Start(); err != nil {
+		// Cleanup
+		os.RemoveAll(base)
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Start starts server process, it is used to restart server stopped by Stop.
+func (d *DnetIOServ) Start() error {
+	ioservCmd := exec.Command("dnet_ioserv", "-c", d.file)
+	if err := ioservCmd.Start(); err != nil {
+		return fmt.Errorf("Could not start dnet_ioserv process: %v\n", err)
 	}
 
 	// wait 1 second for server to start
 	time.Sleep(1 * time.Second)
 
 	// check availability
-	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", d.port))
 	if err != nil {
-		// Cleanup
 		ioservCmd.Process.Kill()
-		os.RemoveAll(base)
-		return nil, err
+		ioservCmd.Wait()
+		return err
 	}
-	defer conn.Close()
+	conn.Close()
 
-	return &DnetIOServ{
-		cmd:    ioservCmd,
-		config: config,
-		base:   base,
-	}, nil
+	d.cmd = ioservCmd
+	return nil
 }
 
-func (d *DnetIOServ) Close() error {
-	defer os.RemoveAll(d.base)
+// Stop kills server process, its config and data are kept.
+func (d *DnetIOServ) Stop() error {
+	if d.cmd == nil {
+		return nil
+	}
+
 	if err := d.cmd.Process.Kill(); err != nil {
 		return err
 	}
 	d.cmd.Wait()
+	d.cmd = nil
 	return nil
 }
 
+func (d *DnetIOServ) Close() error {
+	defer os.RemoveAll(d.base)
+	return d.Stop()
+}
+
 func (d *DnetIOServ) Address() []string {
 	return d.config.Options.Address
 }
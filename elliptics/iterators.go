@@ -50,6 +50,7 @@ static inline void unpack_dnet_iterator_response(struct dnet_iterator_response *
 import "C"
 
 import (
+	"context"
 	"fmt"
 	"time"
 	"unsafe"
@@ -108,6 +109,9 @@ func (i *iteratorResult) Error() error { return i.err }
 //export go_iterator_callback
 func go_iterator_callback(result *C.struct_go_iterator_result, key uint64) {
 	context, err := Pool.Get(key)
+	if err == ContextCancelledError {
+		return
+	}
 	if err != nil {
 		panic("Unable to find session number")
 	}
@@ -144,37 +148,40 @@ func go_iterator_callback(result *C.struct_go_iterator_result, key uint64) {
 }
 
 func iteratorHelper(id *DnetRawID) (*Key, uint64, uint64, *DChannel, error) {
-	responseCh := NewDChannel()
+	ekey, _, onResultContext, onFinishContext, responseCh, err := iteratorHelperCtx(context.Background(), id)
+	return ekey, onResultContext, onFinishContext, responseCh, err
+}
+
+func iteratorHelperCtx(ctx context.Context, id *DnetRawID) (*Key, *asyncOp, uint64, uint64, *DChannel, error) {
+	responseCh := NewDChannelCtx(ctx)
 	ekey, err := NewKey()
 	if err != nil {
 		responseCh.In <- &iteratorResult{err: err}
 		close(responseCh.In)
 
-		return nil, 0, 0, responseCh, err
+		return nil, nil, 0, 0, responseCh, err
 	}
 
 	ekey.SetRawId(id.ID)
 
-	onResultContext := NextContext()
-	onFinishContext := NextContext()
+	op := newAsyncOp(ctx)
 
 	onResult := func(iterres *iteratorResult) {
-		responseCh.In <- iterres
+		op.Deliver(func() {
+			op.sendAny(responseCh.In, iterres)
+		})
 	}
 
 	onFinish := func(err error) {
 		if err != nil {
-			responseCh.In <- &iteratorResult{err: err}
+			op.sendAny(responseCh.In, &iteratorResult{err: err})
 		}
 		close(responseCh.In)
-
-		Pool.Delete(onResultContext)
-		Pool.Delete(onFinishContext)
 	}
 
-	Pool.Store(onResultContext, onResult)
-	Pool.Store(onFinishContext, onFinish)
-	return ekey, onResultContext, onFinishContext, responseCh, nil
+	onResultContext := op.Store(onResult)
+	onFinishContext := op.Finish(onFinish)
+	return ekey, op, onResultContext, onFinishContext, responseCh, nil
 }
 
 func adjustTimeFrame(ctime_begin, ctime_end *C.struct_dnet_time, timeFrame ...time.Time) error {
@@ -228,7 +235,24 @@ func convertRanges(ranges []DnetIteratorRange) []C.struct_go_iterator_range {
 
 func (s *Session) IteratorStart(id *DnetRawID, ranges []DnetIteratorRange,
 		itype uint64, iflags uint64, timeFrame ...time.Time) *DChannel {
-	ekey, onResultContext, onFinishContext, responseCh, err := iteratorHelper(id)
+	return s.IteratorStartCtx(context.Background(), id, ranges, itype, iflags, timeFrame...)
+}
+
+// IteratorStartCtx starts iterator like IteratorStart, but stops delivering its results when @ctx is done.
+// Cancelling the context does not stop iterator on the server, use IteratorCancel() for that.
+func (s *Session) IteratorStartCtx(ctx context.Context, id *DnetRawID, ranges []DnetIteratorRange,
+		itype uint64, iflags uint64, timeFrame ...time.Time) *DChannel {
+	session, release, err := s.contextSession(ctx, nil)
+	if err != nil {
+		responseCh := NewDChannel()
+		responseCh.In <- &iteratorResult{err: err}
+		close(responseCh.In)
+		return responseCh
+	}
+	defer release()
+	s.keepFilter(session)
+
+	ekey, op, onResultContext, onFinishContext, responseCh, err := iteratorHelperCtx(ctx, id)
 	if err != nil {
 		return responseCh
 	}
@@ -237,11 +261,7 @@ func (s *Session) IteratorStart(id *DnetRawID, ranges []DnetIteratorRange,
 	var ctime_begin, ctime_end C.struct_dnet_time
 
 	if err := adjustTimeFrame(&ctime_begin, &ctime_end, timeFrame...); err != nil {
-		context, pool_err := Pool.Get(onFinishContext)
-		if pool_err != nil {
-			panic("Unable to find session number")
-		}
-		context.(func(error))(err)
+		op.Stop(err)
 		return responseCh
 	}
 	if len(timeFrame) != 0 {
@@ -252,7 +272,7 @@ func (s *Session) IteratorStart(id *DnetRawID, ranges []DnetIteratorRange,
 	iflags |= DNET_IFLAGS_KEY_RANGE
 	cranges := convertRanges(ranges)
 
-	C.session_start_iterator(s.session, C.context_t(onResultContext), C.context_t(onFinishContext),
+	C.session_start_iterator(session.session, C.context_t(onResultContext), C.context_t(onFinishContext),
 		(*C.struct_go_iterator_range)(&cranges[0]),
 		C.size_t(len(cranges)),
 		ekey.key,
@@ -0,0 +1,198 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultLatencyWindow is the number of latest samples kept for every address
+	defaultLatencyWindow = 128
+
+	// latencyMinSamples is the number of samples needed to compute percentiles
+	latencyMinSamples = 10
+
+	// latencyEWMAWeight is the weight of the new sample in moving average
+	latencyEWMAWeight = 0.2
+)
+
+type addrLatency struct {
+	samples []time.Duration
+	next    int
+	ewma    time.Duration
+}
+
+func (a *addrLatency) observe(d time.Duration, window int) {
+	if len(a.samples) < window {
+		a.samples = append(a.samples, d)
+	} else {
+		a.samples[a.next] = d
+		a.next = (a.next + 1) % window
+	}
+
+	if a.ewma == 0 {
+		a.ewma = d
+	} else {
+		a.ewma += time.Duration(latencyEWMAWeight * float64(d-a.ewma))
+	}
+}
+
+func (a *addrLatency) percentile(p float64) time.Duration {
+	sorted := append([]time.Duration(nil), a.samples...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	idx := int(p*float64(len(sorted))+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+
+	return sorted[idx]
+}
+
+// LatencyTracker keeps reply latencies of every server address and remembers which address served every group.
+// It is safe for concurrent use.
+type LatencyTracker struct {
+	mutex  sync.Mutex
+	window int
+	addrs  map[string]*addrLatency
+	groups map[uint32]string
+}
+
+// NewLatencyTracker returns tracker which keeps @window latest samples for every address.
+func NewLatencyTracker(window int) *LatencyTracker {
+	if window <= 0 {
+		window = defaultLatencyWindow
+	}
+
+	return &LatencyTracker{
+		window: window,
+		addrs:  make(map[string]*addrLatency),
+		groups: make(map[uint32]string),
+	}
+}
+
+// Observe records that the server @addr has replied for @group in @d.
+func (t *LatencyTracker) Observe(group uint32, addr *DnetAddr, d time.Duration) {
+	key := addr.String()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	a, ok := t.addrs[key]
+	if !ok {
+		a = &addrLatency{}
+		t.addrs[key] = a
+	}
+
+	a.observe(d, t.window)
+	t.groups[group] = key
+}
+
+// ObserveLowerBound records that request to @group has been abandoned after @d without reply,
+// so its latency is at least @d. Sample is recorded for the address which has served @group last time,
+// it only raises the average and is ignored if the average is already higher.
+func (t *LatencyTracker) ObserveLowerBound(group uint32, d time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key, ok := t.groups[group]
+	if !ok {
+		// no address has replied for the group yet
+		key = fmt.Sprintf("group %d", group)
+		t.groups[group] = key
+	}
+
+	a, ok := t.addrs[key]
+	if !ok {
+		a = &addrLatency{}
+		t.addrs[key] = a
+	}
+
+	if d > a.ewma {
+		a.observe(d, t.window)
+	}
+}
+
+func (t *LatencyTracker) group(group uint32) *addrLatency {
+	key, ok := t.groups[group]
+	if !ok {
+		return nil
+	}
+
+	return t.addrs[key]
+}
+
+// Average returns moving average of latency of the address which has served @group last time.
+func (t *LatencyTracker) Average(group uint32) (time.Duration, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	a := t.group(group)
+	if a == nil {
+		return 0, false
+	}
+
+	return a.ewma, true
+}
+
+// Percentile returns @p-th (0 < @p <= 1) percentile of latency of the address which has served @group last time.
+// It returns false until enough samples have been collected.
+func (t *LatencyTracker) Percentile(group uint32, p float64) (time.Duration, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	a := t.group(group)
+	if a == nil || len(a.samples) < latencyMinSamples {
+		return 0, false
+	}
+
+	return a.percentile(p), true
+}
+
+// Order returns copy of @groups sorted by average latency, groups without samples go last
+// keeping their order, so they are only tried when faster groups do not reply in time.
+func (t *LatencyTracker) Order(groups []uint32) []uint32 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	avg := make(map[uint32]time.Duration, len(groups))
+	for _, group := range groups {
+		if a := t.group(group); a != nil {
+			avg[group] = a.ewma
+		}
+	}
+
+	ret := append([]uint32(nil), groups...)
+	sort.SliceStable(ret, func(i, j int) bool {
+		ai, iok := avg[ret[i]]
+		aj, jok := avg[ret[j]]
+		if iok != jok {
+			return iok
+		}
+		return ai < aj
+	})
+
+	return ret
+}
@@ -0,0 +1,85 @@
+/*
+* 2013+ Copyright (c) Anton Tyurin <noxiouz@yandex.ru>
+* All rights reserved.
+*
+* This program is free software; you can redistribute it and/or modify
+* it under the terms of the GNU General Public License as published by
+* the Free Software Foundation; either version 3 of the License, or
+* (at your option) any later version.
+*
+* This program is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU General Public License for more details.
+*/
+
+#include "logger.h"
+
+#include <sstream>
+#include <vector>
+
+extern "C" {
+#include "_cgo_export.h"
+}
+
+namespace {
+
+struct attribute_to_string : public boost::static_visitor<std::string> {
+	template <typename T>
+	std::string operator()(const T &value) const {
+		std::ostringstream ss;
+		ss << value;
+		return ss.str();
+	}
+
+	std::string operator()(const timeval &tv) const {
+		std::ostringstream ss;
+		ss << tv.tv_sec << "." << tv.tv_usec;
+		return ss.str();
+	}
+};
+
+} // namespace
+
+void go_log_frontend::handle(const blackhole::log::record_t &record)
+{
+	int level = DNET_LOG_INFO;
+	std::string message;
+	std::vector<std::string> keys, values;
+
+	const std::string severity = blackhole::keyword::severity<dnet_log_level>().name();
+
+	for (const auto &attr : record.attributes()) {
+		if (attr.first == severity) {
+			level = record.extract<dnet_log_level>(severity);
+			continue;
+		}
+
+		std::string value = boost::apply_visitor(attribute_to_string(), attr.second.value);
+		if (attr.first == "message") {
+			message = value;
+			continue;
+		}
+
+		// record time is taken on Go side
+		if (attr.first == "timestamp")
+			continue;
+
+		keys.push_back(attr.first);
+		values.push_back(value);
+	}
+
+	std::vector<char *> ckeys, cvalues;
+	for (size_t i = 0; i < keys.size(); ++i) {
+		ckeys.push_back(const_cast<char *>(keys[i].c_str()));
+		cvalues.push_back(const_cast<char *>(values[i].c_str()));
+	}
+
+	go_log_record(m_key, level, const_cast<char *>(message.c_str()),
+			ckeys.data(), cvalues.data(), ckeys.size());
+}
+
+go_logger::go_logger(uint64_t key, dnet_log_level level) : ioremap::elliptics::logger_base(level)
+{
+	add_frontend(blackhole::utils::make_unique<go_log_frontend>(key));
+}
@@ -15,9 +15,194 @@
 
 package elliptics
 
-import "unsafe"
+/*
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// LogLevel is the severity of the log record, values match elliptics dnet_log_level.
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota
+	LogNotice
+	LogInfo
+	LogWarning
+	LogError
+)
+
+var LogLevelString = map[LogLevel]string{
+	LogDebug:   "debug",
+	LogNotice:  "notice",
+	LogInfo:    "info",
+	LogWarning: "warning",
+	LogError:   "error",
+}
+
+func (l LogLevel) String() string {
+	if s, ok := LogLevelString[l]; ok {
+		return s
+	}
+	return fmt.Sprintf("level-%d", int(l))
+}
+
+// ParseLogLevel converts level name used by elliptics configs ("debug", "notice", "info", "warning", "error") into LogLevel.
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, s := range LogLevelString {
+		if strings.EqualFold(s, name) {
+			return level, nil
+		}
+	}
+
+	return LogInfo, fmt.Errorf("unknown log level: %s", name)
+}
+
+// LogRecord is one record of elliptics client library or of this package.
+type LogRecord struct {
+	Time    time.Time
+	Level   LogLevel
+	Message string
+
+	// attributes attached to the record, for example request id or address of the server
+	Attributes map[string]string
+}
+
+// Logger receives log records, Log is called from elliptics IO threads and must not block for long.
+type Logger interface {
+	Log(rec *LogRecord)
+}
+
+// LoggerFunc adapts ordinary function to Logger interface.
+type LoggerFunc func(rec *LogRecord)
+
+func (f LoggerFunc) Log(rec *LogRecord) {
+	f(rec)
+}
+
+// DiscardLogger drops all records.
+var DiscardLogger Logger = LoggerFunc(func(*LogRecord) {})
+
+// NewStdLogger returns logger which prints records with @level severity and higher into @l.
+func NewStdLogger(l *log.Logger, level LogLevel) Logger {
+	return LoggerFunc(func(rec *LogRecord) {
+		if rec.Level < level {
+			return
+		}
+
+		keys := make([]string, 0, len(rec.Attributes))
+		for k := range rec.Attributes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		var attrs strings.Builder
+		for _, k := range keys {
+			fmt.Fprintf(&attrs, " %s=%s", k, rec.Attributes[k])
+		}
+
+		l.Printf("%s: %s%s", strings.ToUpper(rec.Level.String()), rec.Message, attrs.String())
+	})
+}
+
+type jsonRecord struct {
+	Time       string            `json:"time"`
+	Level      string            `json:"level"`
+	Message    string            `json:"message"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// NewJSONLogger returns logger which writes records with @level severity and higher into @w as JSON, one object per line.
+func NewJSONLogger(w io.Writer, level LogLevel) Logger {
+	var mutex sync.Mutex
+	enc := json.NewEncoder(w)
+
+	return LoggerFunc(func(rec *LogRecord) {
+		if rec.Level < level {
+			return
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		enc.Encode(&jsonRecord{
+			Time:       rec.Time.Format(time.RFC3339Nano),
+			Level:      rec.Level.String(),
+			Message:    rec.Message,
+			Attributes: rec.Attributes,
+		})
+	})
+}
+
+var (
+	loggerMutex   sync.RWMutex
+	packageLogger = NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), LogInfo)
+)
+
+// SetLogger sets logger used by this package itself, for example for statistics parsing messages, nil discards them.
+// By default messages with info severity and higher are printed by standard log package into stderr.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = DiscardLogger
+	}
+
+	loggerMutex.Lock()
+	packageLogger = l
+	loggerMutex.Unlock()
+}
+
+// GetLogger returns logger used by this package.
+func GetLogger() Logger {
+	loggerMutex.RLock()
+	defer loggerMutex.RUnlock()
+
+	return packageLogger
+}
+
+// logf sends record into package logger, @attrs may be nil.
+func logf(level LogLevel, attrs map[string]string, format string, args ...interface{}) {
+	GetLogger().Log(&LogRecord{
+		Time:       time.Now(),
+		Level:      level,
+		Message:    fmt.Sprintf(format, args...),
+		Attributes: attrs,
+	})
+}
+
+//export go_log_record
+func go_log_record(key uint64, level C.int, message *C.char, keys **C.char, values **C.char, num C.int) {
+	context, err := Pool.Get(key)
+	if err != nil {
+		return
+	}
+	logger := context.(Logger)
+
+	rec := &LogRecord{
+		Time:       time.Now(),
+		Level:      LogLevel(level),
+		Message:    C.GoString(message),
+		Attributes: make(map[string]string, int(num)),
+	}
+
+	if num > 0 {
+		ckeys := (*[1 << 20]*C.char)(unsafe.Pointer(keys))[:num:num]
+		cvalues := (*[1 << 20]*C.char)(unsafe.Pointer(values))[:num:num]
+		for i := range ckeys {
+			rec.Attributes[C.GoString(ckeys[i])] = C.GoString(cvalues[i])
+		}
+	}
 
-//Logger provides file logger for Elliptics Node.
-type Logger struct {
-	logger unsafe.Pointer
+	logger.Log(rec)
 }
@@ -0,0 +1,41 @@
+/*
+ * 2013+ Copyright (c) Anton Tyurin <noxiouz@yandex.ru>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+#ifndef __ELLIPTICS_LOGGER_H
+#define __ELLIPTICS_LOGGER_H
+
+#ifdef __cplusplus
+#include <elliptics/logger.hpp>
+
+#include <blackhole/frontend.hpp>
+
+// go_log_frontend passes every log record to the Go logger stored in the Pool under @key
+class go_log_frontend : public blackhole::base_frontend_t {
+public:
+	go_log_frontend(uint64_t key) : m_key(key) {}
+
+	virtual void handle(const blackhole::log::record_t &record);
+
+private:
+	uint64_t m_key;
+};
+
+class go_logger : public ioremap::elliptics::logger_base {
+public:
+	go_logger(uint64_t key, dnet_log_level level);
+};
+#endif
+
+#endif
@@ -0,0 +1,326 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Operation names reported in OperationEvent.Op.
+const (
+	OpRead        = "read"
+	OpWrite       = "write"
+	OpLookup      = "lookup"
+	OpRemove      = "remove"
+	OpBulkRead    = "bulk_read"
+	OpBulkRemove  = "bulk_remove"
+	OpIndex       = "index"
+	OpFindIndexes = "find_indexes"
+	OpListIndexes = "list_indexes"
+)
+
+// DefaultLatencyBuckets are upper bounds of latency histogram buckets used by MemoryMetrics by default.
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// OperationEvent describes one reply of a session operation.
+// Group, Addr and Backend are taken from the server reply, they are empty for errors
+// of the whole operation like timeout or cancellation.
+type OperationEvent struct {
+	Op      string
+	Group   uint32
+	Addr    *DnetAddr
+	Backend int32
+
+	// time since the operation has been started
+	Latency time.Duration
+
+	BytesRead    uint64
+	BytesWritten uint64
+
+	Err error
+}
+
+func newOperationEvent(cmd *DnetCmd, addr *DnetAddr, err error) OperationEvent {
+	ev := OperationEvent{
+		Group:   cmd.ID.Group,
+		Backend: cmd.Backend,
+		Err:     err,
+	}
+	if addr != nil && len(addr.Addr) != 0 {
+		ev.Addr = addr
+	}
+
+	return ev
+}
+
+// Code returns error code of the event, 0 on success.
+// Context cancellation and deadline are reported as -ECANCELED and -ETIMEDOUT.
+func (ev *OperationEvent) Code() int {
+	switch {
+	case ev.Err == nil:
+		return 0
+	case errors.Is(ev.Err, context.Canceled):
+		return -125 // -ECANCELED
+	case errors.Is(ev.Err, context.DeadlineExceeded):
+		return ErrTimeout.Code
+	}
+
+	return ErrorCode(ev.Err)
+}
+
+// OperationMetrics receives every reply of the operations issued by sessions it is set on.
+// Observe is called from elliptics IO threads and must not block.
+type OperationMetrics interface {
+	Observe(ev OperationEvent)
+}
+
+// SetMetrics sets instrumentation of the session operations, nil disables it.
+// Cloned sessions share the metrics.
+func (s *Session) SetMetrics(m OperationMetrics) {
+	s.metrics = m
+}
+
+func (s *Session) GetMetrics() OperationMetrics {
+	return s.metrics
+}
+
+// OperationKey identifies counters of MemoryMetrics.
+type OperationKey struct {
+	Op      string
+	Group   uint32
+	Addr    string
+	Backend int32
+}
+
+// Histogram counts latencies in buckets, Counts[i] is the number of latencies not greater than Bounds[i]
+// and greater than the previous bound, the last element counts latencies above all bounds.
+type Histogram struct {
+	Bounds []time.Duration
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	idx := sort.Search(len(h.Bounds), func(i int) bool {
+		return d <= h.Bounds[i]
+	})
+
+	h.Counts[idx]++
+	h.Count++
+	h.Sum += d
+}
+
+// OperationStats are counters of one OperationKey.
+type OperationStats struct {
+	// number of replies by error code, 0 counts successful replies
+	Codes map[int]uint64
+
+	Latency Histogram
+
+	BytesRead    uint64
+	BytesWritten uint64
+}
+
+func (st *OperationStats) copy() OperationStats {
+	ret := *st
+
+	ret.Codes = make(map[int]uint64, len(st.Codes))
+	for code, n := range st.Codes {
+		ret.Codes[code] = n
+	}
+	ret.Latency.Counts = append([]uint64(nil), st.Latency.Counts...)
+
+	return ret
+}
+
+// MemoryMetrics is OperationMetrics which keeps counters in memory, it is safe for concurrent use.
+// It implements expvar.Var, so it can be exported with expvar.Publish() or Publish().
+type MemoryMetrics struct {
+	mutex  sync.Mutex
+	bounds []time.Duration
+	ops    map[OperationKey]*OperationStats
+}
+
+// NewMemoryMetrics returns metrics with latency histogram bucket upper bounds @bounds,
+// DefaultLatencyBuckets are used if it is empty.
+func NewMemoryMetrics(bounds []time.Duration) *MemoryMetrics {
+	if len(bounds) == 0 {
+		bounds = DefaultLatencyBuckets
+	}
+
+	bounds = append([]time.Duration(nil), bounds...)
+	sort.Slice(bounds, func(i, j int) bool {
+		return bounds[i] < bounds[j]
+	})
+
+	return &MemoryMetrics{
+		bounds: bounds,
+		ops:    make(map[OperationKey]*OperationStats),
+	}
+}
+
+func (m *MemoryMetrics) Observe(ev OperationEvent) {
+	key := OperationKey{
+		Op:      ev.Op,
+		Group:   ev.Group,
+		Backend: ev.Backend,
+	}
+	if ev.Addr != nil {
+		key.Addr = ev.Addr.String()
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	st, ok := m.ops[key]
+	if !ok {
+		st = &OperationStats{
+			Codes: make(map[int]uint64),
+			Latency: Histogram{
+				Bounds: m.bounds,
+				Counts: make([]uint64, len(m.bounds)+1),
+			},
+		}
+		m.ops[key] = st
+	}
+
+	st.Codes[ev.Code()]++
+	st.Latency.observe(ev.Latency)
+	st.BytesRead += ev.BytesRead
+	st.BytesWritten += ev.BytesWritten
+}
+
+// Snapshot returns copy of all counters.
+func (m *MemoryMetrics) Snapshot() map[OperationKey]OperationStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ret := make(map[OperationKey]OperationStats, len(m.ops))
+	for key, st := range m.ops {
+		ret[key] = st.copy()
+	}
+
+	return ret
+}
+
+// Reset drops all counters.
+func (m *MemoryMetrics) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.ops = make(map[OperationKey]*OperationStats)
+}
+
+type bucketJSON struct {
+	LE    float64 `json:"le"`
+	Count uint64  `json:"count"`
+}
+
+type operationJSON struct {
+	Op      string `json:"op"`
+	Group   uint32 `json:"group"`
+	Addr    string `json:"address"`
+	Backend int32  `json:"backend"`
+
+	Codes map[int]uint64 `json:"codes"`
+
+	Count          uint64       `json:"count"`
+	LatencySeconds float64      `json:"latency_sum_seconds"`
+	Buckets        []bucketJSON `json:"latency_buckets"`
+
+	BytesRead    uint64 `json:"bytes_read"`
+	BytesWritten uint64 `json:"bytes_written"`
+}
+
+// String returns all counters as JSON array, this is expvar.Var interface.
+// Latency buckets are cumulative and bounded by seconds like in Prometheus histograms.
+func (m *MemoryMetrics) String() string {
+	snapshot := m.Snapshot()
+
+	ops := make([]operationJSON, 0, len(snapshot))
+	for key, st := range snapshot {
+		op := operationJSON{
+			Op:             key.Op,
+			Group:          key.Group,
+			Addr:           key.Addr,
+			Backend:        key.Backend,
+			Codes:          st.Codes,
+			Count:          st.Latency.Count,
+			LatencySeconds: st.Latency.Sum.Seconds(),
+			Buckets:        make([]bucketJSON, 0, len(st.Latency.Bounds)),
+			BytesRead:      st.BytesRead,
+			BytesWritten:   st.BytesWritten,
+		}
+
+		var cumulative uint64
+		for i, bound := range st.Latency.Bounds {
+			cumulative += st.Latency.Counts[i]
+			op.Buckets = append(op.Buckets, bucketJSON{
+				LE:    bound.Seconds(),
+				Count: cumulative,
+			})
+		}
+
+		ops = append(ops, op)
+	}
+
+	sort.Slice(ops, func(i, j int) bool {
+		a, b := &ops[i], &ops[j]
+		if a.Op != b.Op {
+			return a.Op < b.Op
+		}
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		if a.Addr != b.Addr {
+			return a.Addr < b.Addr
+		}
+		return a.Backend < b.Backend
+	})
+
+	data, err := json.Marshal(ops)
+	if err != nil {
+		return "[]"
+	}
+
+	return string(data)
+}
+
+// Publish exports metrics as expvar variable @name, it panics if the name is already in use.
+func (m *MemoryMetrics) Publish(name string) {
+	expvar.Publish(name, m)
+}
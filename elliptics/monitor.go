@@ -0,0 +1,219 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultStatMonitorInterval = 30 * time.Second
+	defaultStatMonitorHistory  = 16
+)
+
+/*
+StatMonitor collects statistics in background every interval and keeps a ring buffer of the latest snapshots.
+
+Every new snapshot is diffed against the previous one (see DnetStat.Diff), so differential counters
+and PID state are always up to date. Published snapshots are never modified by the monitor and must be
+treated as read-only by callers, thus they can be used from any number of goroutines without locking.
+*/
+type StatMonitor struct {
+	session  *Session
+	interval time.Duration
+
+	mutex   sync.RWMutex
+	history []*DnetStat
+	next    int
+	err     error
+
+	subscribers map[chan *DnetStat]struct{}
+
+	// called with every new snapshot before it is published, for example GroupSelector.Update
+	onUpdate func(*DnetStat)
+
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewStatMonitor starts collecting statistics through @session every @interval, @history latest snapshots are kept.
+// @onUpdate (if not nil) is called with every new snapshot after it has been diffed and before it is published.
+// The first snapshot is requested immediately.
+func NewStatMonitor(session *Session, interval time.Duration, history int, onUpdate func(*DnetStat)) *StatMonitor {
+	if interval <= 0 {
+		interval = defaultStatMonitorInterval
+	}
+	if history <= 0 {
+		history = defaultStatMonitorHistory
+	}
+
+	m := &StatMonitor{
+		session:     session,
+		interval:    interval,
+		history:     make([]*DnetStat, 0, history),
+		subscribers: make(map[chan *DnetStat]struct{}),
+		onUpdate:    onUpdate,
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+
+	m.wg.Add(1)
+	go m.loop()
+
+	return m
+}
+
+func (m *StatMonitor) loop() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.poll()
+
+		select {
+		case <-ticker.C:
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *StatMonitor) poll() {
+	ctx, cancel := context.WithTimeout(m.ctx, m.interval)
+	defer cancel()
+
+	stat, err := m.session.DnetStatCtx(ctx)
+	if err != nil {
+		m.mutex.Lock()
+		m.err = err
+		m.mutex.Unlock()
+		return
+	}
+
+	if stat.Time.IsZero() {
+		stat.Time = time.Now()
+	}
+
+	stat.Diff(m.Latest())
+	if m.onUpdate != nil {
+		m.onUpdate(stat)
+	}
+
+	m.publish(stat)
+}
+
+func (m *StatMonitor) publish(stat *DnetStat) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(m.history) < cap(m.history) {
+		m.history = append(m.history, stat)
+	} else {
+		m.history[m.next] = stat
+		m.next = (m.next + 1) % len(m.history)
+	}
+	m.err = nil
+
+	for ch := range m.subscribers {
+		// slow subscribers miss updates instead of blocking the monitor
+		select {
+		case ch <- stat:
+		default:
+		}
+	}
+}
+
+// Latest returns the latest snapshot or nil if none has been collected yet.
+func (m *StatMonitor) Latest() *DnetStat {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if len(m.history) == 0 {
+		return nil
+	}
+
+	if len(m.history) < cap(m.history) {
+		return m.history[len(m.history)-1]
+	}
+
+	return m.history[(m.next+len(m.history)-1)%len(m.history)]
+}
+
+// History returns kept snapshots, the oldest first.
+func (m *StatMonitor) History() []*DnetStat {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	ret := make([]*DnetStat, 0, len(m.history))
+	if len(m.history) < cap(m.history) {
+		return append(ret, m.history...)
+	}
+
+	ret = append(ret, m.history[m.next:]...)
+	return append(ret, m.history[:m.next]...)
+}
+
+// Err returns error of the latest failed poll, it is reset by the next successful one.
+func (m *StatMonitor) Err() error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.err
+}
+
+// Subscribe returns channel which receives every new snapshot, up to @buffer snapshots are queued
+// and newer ones are dropped if the subscriber does not keep up.
+// Returned function unsubscribes and closes the channel.
+func (m *StatMonitor) Subscribe(buffer int) (<-chan *DnetStat, func()) {
+	ch := make(chan *DnetStat, buffer)
+
+	m.mutex.Lock()
+	m.subscribers[ch] = struct{}{}
+	m.mutex.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+
+			if _, ok := m.subscribers[ch]; ok {
+				delete(m.subscribers, ch)
+				close(ch)
+			}
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+// Close stops polling and closes all subscription channels.
+func (m *StatMonitor) Close() {
+	m.cancel()
+	m.wg.Wait()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for ch := range m.subscribers {
+		delete(m.subscribers, ch)
+		close(ch)
+	}
+}
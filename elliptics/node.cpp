@@ -48,6 +48,19 @@ ell_node *new_node_config(const char *logfile, const char *level, struct dnet_co
 	}
 }
 
+ell_node *new_node_logger(uint64_t logger, const char *level, struct dnet_config *cfg)
+{
+	try {
+		std::shared_ptr<elliptics::logger_base> base =
+			std::make_shared<go_logger>(logger, elliptics::file_logger::parse_level(level));
+
+		return new ell_node(base, *cfg);
+	} catch (const std::exception &e) {
+		fprintf(stderr, "could not create new node: exception: %s\n", e.what());
+		return NULL;
+	}
+}
+
 void delete_node(ell_node *node)
 {
 	delete node;
@@ -41,6 +41,7 @@ import "C"
 
 import (
 	"fmt"
+	"io"
 	"syscall"
 	"unsafe"
 )
@@ -50,6 +51,23 @@ import (
 // To initialize the Node you should use NewNode.
 type Node struct {
 	node unsafe.Pointer
+
+	// Pool context of the Go logger if node was created by NewNodeLogger
+	logger uint64
+
+	// log file opened by ClientConfig.NewNode for the Go logger, it is closed by Free
+	logfile io.Closer
+
+	// remotes added to the node and states of connections to them
+	remotes *nodeRemotes
+}
+
+func newNode(cnode unsafe.Pointer, logger uint64) *Node {
+	return &Node{
+		node:    cnode,
+		logger:  logger,
+		remotes: newNodeRemotes(),
+	}
 }
 
 type NodeConfig struct {
@@ -62,14 +80,18 @@ type NodeConfig struct {
 	StallCount		int			`json:"stall-count"`
 }
 
-// NewNode returns new Node with a given Logger.
-func NewNodeConfig(logfile string, level string, cfg *NodeConfig) (node *Node, err error) {
-	clevel := C.CString(level)
-	defer C.free(unsafe.Pointer(clevel))
-
-	clogfile := C.CString(logfile)
-	defer C.free(unsafe.Pointer(clogfile))
+// DefaultNodeConfig returns config NewNode uses.
+func DefaultNodeConfig() *NodeConfig {
+	return &NodeConfig{
+		IOThreadNum:            8,
+		NonBlockingIOThreadNum: 4,
+		NetThreadNum:           4,
+		WaitTimeout:            15,
+		CheckTimeout:           30,
+	}
+}
 
+func (cfg *NodeConfig) dnetConfig() C.struct_dnet_config {
 	var dcfg C.struct_dnet_config
 	C.memset(unsafe.Pointer(&dcfg), 0, C.sizeof_struct_dnet_config)
 
@@ -81,12 +103,53 @@ func NewNodeConfig(logfile string, level string, cfg *NodeConfig) (node *Node, e
 	dcfg.flags = C.int(cfg.Flags)
 	dcfg.stall_count = C.long(cfg.StallCount)
 
+	return dcfg
+}
+
+// NewNode returns new Node with a given Logger.
+func NewNodeConfig(logfile string, level string, cfg *NodeConfig) (node *Node, err error) {
+	clevel := C.CString(level)
+	defer C.free(unsafe.Pointer(clevel))
+
+	clogfile := C.CString(logfile)
+	defer C.free(unsafe.Pointer(clogfile))
+
+	dcfg := cfg.dnetConfig()
+
 	cnode := C.new_node_config(clogfile, clevel, &dcfg)
 	if cnode == nil {
 		err = fmt.Errorf("could not create node, please check stderr output")
 		return
 	}
-	node = &Node{cnode}
+	node = newNode(cnode, 0)
+	return
+}
+
+// NewNodeLogger returns new Node which sends log records of elliptics client library with @level severity
+// and higher into @logger instead of a file, nil @logger discards them. Default config is used if @cfg is nil.
+func NewNodeLogger(logger Logger, level string, cfg *NodeConfig) (node *Node, err error) {
+	if cfg == nil {
+		cfg = DefaultNodeConfig()
+	}
+	if logger == nil {
+		logger = DiscardLogger
+	}
+
+	clevel := C.CString(level)
+	defer C.free(unsafe.Pointer(clevel))
+
+	key := NextContext()
+	Pool.Store(key, logger)
+
+	dcfg := cfg.dnetConfig()
+
+	cnode := C.new_node_logger(C.uint64_t(key), clevel, &dcfg)
+	if cnode == nil {
+		Pool.Delete(key)
+		err = fmt.Errorf("could not create node, please check stderr output")
+		return
+	}
+	node = newNode(cnode, key)
 	return
 }
 
@@ -103,14 +166,22 @@ func NewNode(logfile string, level string) (node *Node, err error) {
 		err = fmt.Errorf("could not create node, please check stderr output")
 		return
 	}
-	node = &Node{cnode}
+	node = newNode(cnode, 0)
 	return
 }
 
 // Free disposes given Node instance.
 // Do not destroy the Node used by any Session.
 func (node *Node) Free() {
+	node.StopHealthCheck()
 	C.delete_node(node.node)
+
+	if node.logger != 0 {
+		Pool.Delete(node.logger)
+	}
+	if node.logfile != nil {
+		node.logfile.Close()
+	}
 }
 
 // Get raw elliptics node pointer
@@ -139,6 +210,12 @@ func (node *Node) SetTimeouts(waitTimeout int, checkTimeout int) {
  * Suitable Family values are: 2 (AF_INET) and 10 (AF_INET6).
  */
 func (node *Node) AddRemote(addr string) (err error) {
+	err = node.addRemote(addr)
+	node.remotesAdded([]string{addr}, err)
+	return
+}
+
+func (node *Node) addRemote(addr string) (err error) {
 	caddr := C.CString(addr)
 	defer C.free(unsafe.Pointer(caddr))
 
@@ -174,5 +251,6 @@ func (node *Node) AddRemotes(addrs []string) (err error) {
 	if c_err < 0 {
 		err = syscall.Errno(-c_err)
 	}
+	node.remotesAdded(addrs, err)
 	return
 }
@@ -23,9 +23,11 @@
 #include <blackhole/formatter/string.hpp>
 #undef BOOST_BIND_NO_PLACEHOLDERS
 
+#include "logger.h"
+
 class ell_node {
 public:
-	ell_node(std::shared_ptr<ioremap::elliptics::file_logger> &base, dnet_config &cfg)
+	ell_node(const std::shared_ptr<ioremap::elliptics::logger_base> &base, dnet_config &cfg)
 		: m_node(new ioremap::elliptics::node(ioremap::elliptics::logger(*base, blackhole::log::attributes_t({
 							ioremap::elliptics::keyword::request_id() = 0
 							})
@@ -40,7 +42,7 @@ public:
 
 private:
 	std::shared_ptr<ioremap::elliptics::node> m_node;
-	std::shared_ptr<ioremap::elliptics::file_logger> m_log;
+	std::shared_ptr<ioremap::elliptics::logger_base> m_log;
 };
 
 extern "C" {
@@ -52,6 +54,7 @@ typedef void ell_node;
 
 ell_node *new_node(const char *logfile, const char *level);
 ell_node *new_node_config(const char *logfile, const char *level, struct dnet_config *cfg);
+ell_node *new_node_logger(uint64_t logger, const char *level, struct dnet_config *cfg);
 void delete_node(ell_node *node);
 
 int node_add_remote(ell_node *node, const char *addr, int port, int family);
@@ -1,6 +1,8 @@
 package elliptics
 
 import (
+	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"time"
@@ -11,6 +13,7 @@ import (
 func init() {
 	Suite(&NodeSuite{})
 	Suite(&LoggerSuite{})
+	Suite(&ConfigSuite{})
 }
 
 type LoggerSuite struct{}
@@ -20,6 +23,157 @@ func (s *LoggerSuite) TestLogLevelParsing(c *C) {
 	c.Assert(err, ErrorMatches, "could not create node, please check stderr output")
 }
 
+func (s *LoggerSuite) TestNodeLogger(c *C) {
+	records := make(chan *LogRecord, 1024)
+	logger := LoggerFunc(func(rec *LogRecord) {
+		select {
+		case records <- rec:
+		default:
+		}
+	})
+
+	node, err := NewNodeLogger(logger, "info", nil)
+	c.Assert(err, IsNil)
+	defer func() {
+		time.Sleep(1 * time.Second)
+		node.Free()
+	}()
+
+	select {
+	case rec := <-records:
+		c.Assert(rec.Message, Not(Equals), "")
+		c.Assert(rec.Level >= LogInfo, Equals, true)
+	case <-time.After(5 * time.Second):
+		c.Fatal("no log records from the client library")
+	}
+}
+
+func (s *LoggerSuite) TestNodeNilLogger(c *C) {
+	// records of the client library are discarded instead of panicking in the callback
+	node, err := NewNodeLogger(nil, "debug", nil)
+	c.Assert(err, IsNil)
+	time.Sleep(1 * time.Second)
+	node.Free()
+}
+
+func (s *LoggerSuite) TestPackageLogger(c *C) {
+	var buf bytes.Buffer
+	prev := GetLogger()
+	SetLogger(NewJSONLogger(&buf, LogWarning))
+	defer SetLogger(prev)
+
+	logf(LogInfo, nil, "filtered out")
+	logf(LogError, map[string]string{"addr": "localhost:1025:2"}, "broken %s", "reply")
+
+	var rec map[string]interface{}
+	c.Assert(json.Unmarshal(buf.Bytes(), &rec), IsNil)
+	c.Assert(rec["level"], Equals, "error")
+	c.Assert(rec["message"], Equals, "broken reply")
+	c.Assert(rec["attributes"], DeepEquals, map[string]interface{}{"addr": "localhost:1025:2"})
+
+	level, err := ParseLogLevel("NOTICE")
+	c.Assert(err, IsNil)
+	c.Assert(level, Equals, LogNotice)
+}
+
+type ConfigSuite struct{}
+
+func (s *ConfigSuite) TestParseConfig(c *C) {
+	const data = `
+remotes: ["localhost:1025:2"]
+log: {output: stdout, format: json, level: notice}
+node: {io-threads: 16, wait-timeout: 5s}
+session:
+  groups: [1, 2]
+  namespace: test
+  cflags: [nocache]
+  ioflags: [DNET_IO_FLAGS_NOCSUM, cache]
+  timeout: 1m
+`
+	cfg, err := ParseConfig([]byte(data), "yaml")
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Validate(), IsNil)
+	c.Assert(cfg.Session.Groups, DeepEquals, []uint32{1, 2})
+	c.Assert(time.Duration(cfg.Session.Timeout), Equals, time.Minute)
+
+	ioflags, err := ParseIOflags(cfg.Session.IOflags)
+	c.Assert(err, IsNil)
+	c.Assert(ioflags, Equals, DNET_IO_FLAGS_NOCSUM|DNET_IO_FLAGS_CACHE)
+
+	ncfg := cfg.nodeConfig()
+	c.Assert(ncfg.IOThreadNum, Equals, 16)
+	c.Assert(ncfg.NetThreadNum, Equals, DefaultNodeConfig().NetThreadNum)
+	c.Assert(ncfg.WaitTimeout, Equals, uint64(5))
+
+	os.Setenv("ELLIPTICS_TEST_SESSION_GROUPS", "3, 4")
+	os.Setenv("ELLIPTICS_TEST_NODE_CHECK_TIMEOUT", "90s")
+	defer os.Unsetenv("ELLIPTICS_TEST_SESSION_GROUPS")
+	defer os.Unsetenv("ELLIPTICS_TEST_NODE_CHECK_TIMEOUT")
+
+	c.Assert(cfg.ApplyEnv("ELLIPTICS_TEST_"), IsNil)
+	c.Assert(cfg.Session.Groups, DeepEquals, []uint32{3, 4})
+	c.Assert(time.Duration(cfg.Node.CheckTimeout), Equals, 90*time.Second)
+
+	os.Setenv("ELLIPTICS_TEST_NODE_CHECK_TIMEOUT", "soon")
+	c.Assert(cfg.ApplyEnv("ELLIPTICS_TEST_"), ErrorMatches, "config: ELLIPTICS_TEST_NODE_CHECK_TIMEOUT: .*")
+
+	cfg.Session.Cflags = []string{"nocache", "fast"}
+	c.Assert(cfg.Validate(), ErrorMatches, "config: session.cflags: unknown command flag: fast")
+
+	cfg, err = ParseConfig([]byte(`{"remotes": ["localhost"], "session": {"groups": [1]}}`), "json")
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Validate(), ErrorMatches, "config: remotes: localhost: .*")
+
+	cfg.Remotes = []string{"::1:1025:10", "::1:1025", "localhost:1025:2", "localhost:1025:2-0", "localhost:1025"}
+	c.Assert(cfg.Validate(), IsNil)
+	for _, remote := range []string{"localhost:1025:3", "localhost:0:2", ":1025", "host:port:2"} {
+		cfg.Remotes = []string{remote}
+		c.Check(cfg.Validate(), ErrorMatches, "config: remotes: "+remote+": .*")
+	}
+
+	_, err = ParseConfig([]byte(`{"remotes": ["localhost:1025:2"], "sesion": {"groups": [1]}}`), "json")
+	c.Assert(err, ErrorMatches, `config: could not parse json: .*unknown field "sesion"`)
+}
+
+func (s *ConfigSuite) TestConfigLogFile(c *C) {
+	file, err := ioutil.TempFile("", "elliptics-config-test-log.log")
+	c.Assert(err, IsNil)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	cfg := &ClientConfig{Log: LogConfig{Output: file.Name(), Format: "json"}}
+	logger, logfile, err := cfg.logger()
+	c.Assert(err, IsNil)
+	c.Assert(logfile, NotNil)
+
+	logger.Log(&LogRecord{Level: LogError, Message: "written"})
+	c.Assert(logfile.Close(), IsNil)
+
+	data, err := ioutil.ReadFile(file.Name())
+	c.Assert(err, IsNil)
+	c.Assert(bytes.Contains(data, []byte(`"message":"written"`)), Equals, true)
+
+	// package logger is left alone when the node could not be created
+	var buf bytes.Buffer
+	prev := GetLogger()
+	SetLogger(NewJSONLogger(&buf, LogWarning))
+	defer SetLogger(prev)
+
+	cfg.Remotes = []string{"127.0.0.1:1:2"}
+	cfg.Session.Groups = []uint32{1}
+	_, err = cfg.NewNode()
+	c.Assert(err, NotNil)
+	logf(LogError, nil, "still here")
+	c.Assert(bytes.Contains(buf.Bytes(), []byte(`"message":"still here"`)), Equals, true)
+
+	// text logs into a file are written by the client library itself
+	cfg.Log.Format = "text"
+	logger, logfile, err = cfg.logger()
+	c.Assert(err, IsNil)
+	c.Assert(logger, IsNil)
+	c.Assert(logfile, IsNil)
+}
+
 type NodeSuite struct {
 	logfile *os.File
 	node    *Node
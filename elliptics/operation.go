@@ -0,0 +1,437 @@
+package elliptics
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// asyncOp binds Pool contexts of one asynchronous elliptics request to a context.Context.
+//
+// When the context is cancelled or its deadline expires, result delivery stops, the response
+// channel is closed with the context error and all callbacks are removed from the Pool
+// without waiting for the C++ side to complete the request.
+type asyncOp struct {
+	ctx   context.Context
+	mutex sync.Mutex
+
+	// set when response channel has been closed either by final callback or by cancellation
+	stopped bool
+	stop    func(err error)
+
+	final    uint64
+	keys     []uint64
+	retained []uint64
+
+	// functions called once C++ side has completed the request
+	deferred     []func()
+	deferredOnce sync.Once
+
+	done chan struct{}
+
+	// observe results of the request if session has circuit breaker, metrics or tracer
+	breaker *CircuitBreaker
+	metrics OperationMetrics
+
+	// negative replies have been requested only for the circuit breaker, caller does not get them
+	positive bool
+
+	// span of the operation if session is traced
+	span Span
+
+	// operation name and start time reported to metrics
+	name  string
+	start time.Time
+
+	// number of bytes written by the request, reported with every successful reply
+	written uint64
+}
+
+func newAsyncOp(ctx context.Context) *asyncOp {
+	return &asyncOp{
+		ctx:      ctx,
+		keys:     make([]uint64, 0, 2),
+		retained: make([]uint64, 0),
+		done:     make(chan struct{}),
+		start:    time.Now(),
+	}
+}
+
+// newOp returns operation @name whose results are reported to the session's circuit breaker, metrics and tracer.
+func (s *Session) newOp(ctx context.Context, name string, opts *CallOptions) *asyncOp {
+	op := newAsyncOp(ctx)
+	op.breaker = s.breaker
+	op.metrics = s.metrics
+	op.positive = s.breakerFilter()
+	op.name = name
+
+	if s.tracing != nil && s.tracing.Tracer != nil {
+		op.span = s.tracing.Tracer.StartSpan(ctx, name, s.traceID(ctx, opts))
+	}
+
+	return op
+}
+
+// observe reports reply of the server to the circuit breaker, metrics and span.
+// It returns false if the reply is a negative one which has been requested only for the circuit breaker,
+// such reply must not be passed to the caller.
+func (op *asyncOp) observe(ev OperationEvent) bool {
+	if op.breaker != nil {
+		op.breaker.Observe(ev.Group, ev.Addr, ev.Backend, ev.Err)
+	}
+
+	// overall operation error has no group and is always passed
+	if op.positive && ev.Err != nil && ev.Group != 0 {
+		return false
+	}
+
+	if op.metrics == nil && op.span == nil {
+		return true
+	}
+
+	ev.Op = op.name
+	ev.Latency = time.Since(op.start)
+
+	if op.metrics != nil {
+		op.metrics.Observe(ev)
+	}
+	if op.span != nil {
+		op.span.Reply(ev)
+	}
+
+	return true
+}
+
+// Store puts result callback into the Pool, it is dropped as soon as operation is cancelled.
+func (op *asyncOp) Store(callback interface{}) uint64 {
+	key := NextContext()
+	Pool.Store(key, callback)
+	op.keys = append(op.keys, key)
+	return key
+}
+
+// Retain puts into the Pool a value which C++ code may reference until the final callback arrives,
+// for example write buffer. It is not dropped on cancellation.
+func (op *asyncOp) Retain(value interface{}) uint64 {
+	key := NextContext()
+	Pool.Store(key, value)
+	op.retained = append(op.retained, key)
+	return key
+}
+
+// Defer registers @f to be called when C++ side has completed the request, even if the operation
+// has been cancelled before that. It is used to free C objects which result callbacks may still use.
+// Defer must be called before Finish().
+func (op *asyncOp) Defer(f func()) {
+	op.deferred = append(op.deferred, f)
+}
+
+func (op *asyncOp) runDeferred() {
+	op.deferredOnce.Do(func() {
+		for _, f := range op.deferred {
+			f()
+		}
+	})
+}
+
+// Finish stores final callback of the operation and starts watching the context.
+// @stop is invoked exactly once, either with the error of the operation or with the context error,
+// it must close response channel.
+// Finish must be called after all Store() and Retain() calls.
+func (op *asyncOp) Finish(stop func(err error)) uint64 {
+	return op.Chain(stop, op.Stop)
+}
+
+// Chain is like Finish, but final callback invokes @step, which may issue next request
+// reusing the same contexts, @step must call Stop() when the whole operation completes.
+func (op *asyncOp) Chain(stop func(err error), step func(err error)) uint64 {
+	op.stop = stop
+	op.final = NextContext()
+	Pool.Store(op.final, step)
+
+	if op.ctx.Done() != nil {
+		go op.watch()
+	}
+
+	return op.final
+}
+
+// Stop completes operation: calls @stop if it has not been called yet and removes all contexts from the Pool.
+func (op *asyncOp) Stop(err error) {
+	op.mutex.Lock()
+	if op.stopped {
+		op.mutex.Unlock()
+		// operation has been cancelled, this is the final reply for in-flight request
+		Pool.Delete(op.final)
+		op.runDeferred()
+		return
+	}
+
+	op.stopped = true
+	op.stop(err)
+	op.mutex.Unlock()
+
+	if op.span != nil {
+		op.span.End(err)
+	}
+
+	close(op.done)
+
+	Pool.Delete(op.final)
+	for _, key := range op.keys {
+		Pool.Delete(key)
+	}
+	for _, key := range op.retained {
+		Pool.Delete(key)
+	}
+
+	op.runDeferred()
+}
+
+// Deliver runs @send unless operation has been stopped.
+// @send should not block longer than until Done() is closed.
+func (op *asyncOp) Deliver(send func()) {
+	op.mutex.Lock()
+	defer op.mutex.Unlock()
+
+	if !op.stopped {
+		send()
+	}
+}
+
+// Done returns a channel which is closed when operation's context is done.
+func (op *asyncOp) Done() <-chan struct{} {
+	return op.ctx.Done()
+}
+
+// Err returns context error if operation's context is done.
+func (op *asyncOp) Err() error {
+	return op.ctx.Err()
+}
+
+func (op *asyncOp) watch() {
+	select {
+	case <-op.ctx.Done():
+		op.abort(op.ctx.Err())
+	case <-op.done:
+	}
+}
+
+func (op *asyncOp) abort(err error) {
+	op.mutex.Lock()
+	defer op.mutex.Unlock()
+
+	if op.stopped {
+		return
+	}
+
+	op.stopped = true
+	op.stop(err)
+
+	if op.span != nil {
+		op.span.End(err)
+	}
+
+	var onFinal interface{}
+	if len(op.deferred) != 0 {
+		onFinal = func(error) {
+			Pool.Delete(op.final)
+			op.runDeferred()
+		}
+	}
+
+	Pool.Cancel(op.final, op.keys, op.retained, onFinal)
+}
+
+func (op *asyncOp) sendRead(ch chan ReadResult, r ReadResult) {
+	ev := newOperationEvent(r.Cmd(), r.Addr(), r.Error())
+	ev.BytesRead = uint64(len(r.Data()))
+	if !op.observe(ev) {
+		return
+	}
+
+	select {
+	case ch <- r:
+	default:
+		select {
+		case ch <- r:
+		case <-op.Done():
+		}
+	}
+}
+
+func (op *asyncOp) sendLookup(ch chan Lookuper, r Lookuper) {
+	ev := newOperationEvent(r.Cmd(), r.Addr(), r.Error())
+	if ev.Err == nil {
+		ev.BytesWritten = op.written
+	}
+	if !op.observe(ev) {
+		return
+	}
+
+	select {
+	case ch <- r:
+	default:
+		select {
+		case ch <- r:
+		case <-op.Done():
+		}
+	}
+}
+
+func (op *asyncOp) sendRemove(ch chan Remover, r Remover) {
+	if !op.observe(newOperationEvent(r.Cmd(), nil, r.Error())) {
+		return
+	}
+
+	select {
+	case ch <- r:
+	default:
+		select {
+		case ch <- r:
+		case <-op.Done():
+		}
+	}
+}
+
+func (op *asyncOp) sendAny(ch chan interface{}, r interface{}) {
+	select {
+	case ch <- r:
+	default:
+		select {
+		case ch <- r:
+		case <-op.Done():
+		}
+	}
+}
+
+func (op *asyncOp) sendIndex(ch chan Indexer, r Indexer) {
+	if !op.observe(newOperationEvent(r.Cmd(), r.Addr(), r.Error())) {
+		return
+	}
+
+	select {
+	case ch <- r:
+	default:
+		select {
+		case ch <- r:
+		case <-op.Done():
+		}
+	}
+}
+
+func (op *asyncOp) sendFind(ch chan Finder, r Finder) {
+	op.observe(OperationEvent{Err: r.Error()})
+
+	select {
+	case ch <- r:
+	default:
+		select {
+		case ch <- r:
+		case <-op.Done():
+		}
+	}
+}
+
+func (op *asyncOp) sendList(ch chan Lister, r Lister) {
+	op.observe(OperationEvent{Err: r.Error()})
+
+	select {
+	case ch <- r:
+	default:
+		select {
+		case ch <- r:
+		case <-op.Done():
+		}
+	}
+}
+
+// contextSession returns session to be used for request bound to @ctx with call options @opts.
+// If there are options or context has a deadline which expires earlier than session timeout,
+// session is cloned and options and deadline are applied to the clone, so that the shared session
+// is never modified. Groups whose circuit breaker is open are dropped from the clone.
+// Session with circuit breaker is always cloned with SessionFilterAll, so that the breaker sees
+// failed groups, operations drop negative replies the caller has not asked for.
+// Returned release function must be called right after the request has been issued.
+func (s *Session) contextSession(ctx context.Context, opts *CallOptions) (*Session, func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	opts = s.traceOptions(ctx, opts)
+	deadline, has_deadline := ctx.Deadline()
+
+	if s.breaker != nil {
+		groups := s.groups
+		if opts != nil && len(opts.Groups) != 0 {
+			groups = opts.Groups
+		}
+
+		if allowed := s.breaker.Allow(groups); len(allowed) != len(groups) {
+			opts = opts.clone()
+			opts.Groups = allowed
+		}
+	}
+
+	negative := s.breakerFilter()
+	if opts.empty() && !has_deadline && !negative {
+		return s, func() {}, nil
+	}
+
+	timeout := s.GetTimeout()
+	if !opts.empty() && opts.Timeout != 0 {
+		timeout = timeoutFromDuration(opts.Timeout)
+	}
+	if has_deadline {
+		if dt := timeoutFromDeadline(deadline); timeout <= 0 || dt < timeout {
+			timeout = dt
+		}
+	}
+
+	if opts.empty() && timeout == s.GetTimeout() && !negative {
+		return s, func() {}, nil
+	}
+
+	clone, err := CloneSession(s)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !opts.empty() {
+		opts.apply(clone)
+	}
+	clone.SetTimeout(timeout)
+	if negative {
+		clone.SetFilter(SessionFilterAll)
+	}
+
+	return clone, clone.Delete, nil
+}
+
+// keepFilter restores filter of the session on its clone returned by contextSession(),
+// it is used by requests whose replies carry no group and are not reported to the circuit breaker.
+func (s *Session) keepFilter(clone *Session) {
+	if clone != s && clone.filter != s.filter {
+		clone.SetFilter(s.filter)
+	}
+}
+
+// breakerFilter returns true if session's filter hides negative replies from its circuit breaker.
+func (s *Session) breakerFilter() bool {
+	return s.breaker != nil && s.filter == SessionFilterPositive
+}
+
+// timeoutFromDeadline converts deadline into session timeout in seconds, it is never less than 1 second.
+func timeoutFromDeadline(deadline time.Time) int {
+	return timeoutFromDuration(time.Until(deadline))
+}
+
+// timeoutFromDuration rounds duration up to whole seconds, it is never less than 1 second.
+func timeoutFromDuration(d time.Duration) int {
+	timeout := int((d + time.Second - 1) / time.Second)
+	if timeout < 1 {
+		timeout = 1
+	}
+
+	return timeout
+}
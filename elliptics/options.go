@@ -0,0 +1,192 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"time"
+)
+
+// CallOptions overrides session settings for a single call without touching the session itself.
+// Options are passed to ...Ctx() methods as CallOption arguments, the call then runs
+// on a private clone of the session.
+//
+// Zero values keep corresponding session settings.
+type CallOptions struct {
+	// IOflags are added to session IO flags, ClearIOflags are removed from them
+	IOflags      IOflag
+	ClearIOflags IOflag
+
+	// Cflags are added to session command flags, ClearCflags are removed from them
+	Cflags      Cflag
+	ClearCflags Cflag
+
+	Groups    []uint32
+	Timeout   time.Duration
+	TraceID   TraceID
+	Timestamp time.Time
+	UserFlags uint64
+
+	// CacheLifetime is the lifetime of records written into cache
+	CacheLifetime time.Duration
+
+	// Retry replaces retry policy of the session, it is handled on Go side and does not require session clone
+	Retry *RetryPolicy
+}
+
+// CallOption modifies options of a single call, options are applied in order.
+type CallOption func(opts *CallOptions)
+
+// WithCallOptions returns option which sets all non-zero fields of @opts, flags are added to already set ones.
+func WithCallOptions(opts *CallOptions) CallOption {
+	return func(dst *CallOptions) {
+		if opts == nil {
+			return
+		}
+
+		dst.IOflags |= opts.IOflags
+		dst.ClearIOflags |= opts.ClearIOflags
+		dst.Cflags |= opts.Cflags
+		dst.ClearCflags |= opts.ClearCflags
+
+		if len(opts.Groups) != 0 {
+			dst.Groups = append([]uint32(nil), opts.Groups...)
+		}
+		if opts.Timeout != 0 {
+			dst.Timeout = opts.Timeout
+		}
+		if opts.TraceID != 0 {
+			dst.TraceID = opts.TraceID
+		}
+		if !opts.Timestamp.IsZero() {
+			dst.Timestamp = opts.Timestamp
+		}
+		if opts.UserFlags != 0 {
+			dst.UserFlags = opts.UserFlags
+		}
+		if opts.CacheLifetime != 0 {
+			dst.CacheLifetime = opts.CacheLifetime
+		}
+		if opts.Retry != nil {
+			dst.Retry = opts.Retry
+		}
+	}
+}
+
+// WithGroups sends the call to @groups instead of session groups.
+func WithGroups(groups ...uint32) CallOption {
+	return WithCallOptions(&CallOptions{Groups: groups})
+}
+
+// WithIOflags adds @flags to session IO flags.
+func WithIOflags(flags IOflag) CallOption {
+	return WithCallOptions(&CallOptions{IOflags: flags})
+}
+
+// WithCflags adds @flags to session command flags.
+func WithCflags(flags Cflag) CallOption {
+	return WithCallOptions(&CallOptions{Cflags: flags})
+}
+
+// WithTimeout replaces session timeout, context deadline still applies if it expires earlier.
+func WithTimeout(timeout time.Duration) CallOption {
+	return WithCallOptions(&CallOptions{Timeout: timeout})
+}
+
+// WithRetry replaces retry policy of the session.
+func WithRetry(policy *RetryPolicy) CallOption {
+	return WithCallOptions(&CallOptions{Retry: policy})
+}
+
+// withOptions returns new slice of @options followed by @extra, caller's slice is never modified.
+func withOptions(options []CallOption, extra ...CallOption) []CallOption {
+	ret := make([]CallOption, 0, len(options)+len(extra))
+	ret = append(ret, options...)
+	return append(ret, extra...)
+}
+
+// callOptions collects @opts, it returns nil if there are none.
+func callOptions(opts []CallOption) *CallOptions {
+	if len(opts) == 0 {
+		return nil
+	}
+
+	ret := &CallOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(ret)
+		}
+	}
+
+	return ret
+}
+
+// option returns CallOption which passes @opts down to another call.
+func (opts *CallOptions) option() CallOption {
+	return func(dst *CallOptions) {
+		if opts != nil {
+			*dst = *opts.clone()
+		}
+	}
+}
+
+// clone returns a copy of @opts which can be modified by the caller, it is never nil.
+func (opts *CallOptions) clone() *CallOptions {
+	ret := &CallOptions{}
+	if opts != nil {
+		*ret = *opts
+		ret.Groups = append([]uint32(nil), opts.Groups...)
+	}
+
+	return ret
+}
+
+// empty returns true if there are no options to be applied to the session.
+func (opts *CallOptions) empty() bool {
+	return opts == nil ||
+		(opts.IOflags == 0 && opts.ClearIOflags == 0 &&
+			opts.Cflags == 0 && opts.ClearCflags == 0 &&
+			len(opts.Groups) == 0 && opts.Timeout == 0 &&
+			opts.TraceID == 0 && opts.Timestamp.IsZero() &&
+			opts.UserFlags == 0 && opts.CacheLifetime == 0)
+}
+
+// apply sets options on @s, it must only be called for private session clone.
+func (opts *CallOptions) apply(s *Session) {
+	if opts.IOflags != 0 || opts.ClearIOflags != 0 {
+		s.SetIOflags((s.GetIOflags() | opts.IOflags) &^ opts.ClearIOflags)
+	}
+	if opts.Cflags != 0 || opts.ClearCflags != 0 {
+		s.SetCflags((s.GetCflags() | opts.Cflags) &^ opts.ClearCflags)
+	}
+	if len(opts.Groups) != 0 {
+		s.SetGroups(opts.Groups)
+	}
+	if opts.Timeout != 0 {
+		s.SetTimeout(timeoutFromDuration(opts.Timeout))
+	}
+	if opts.TraceID != 0 {
+		s.SetTraceID(opts.TraceID)
+	}
+	if !opts.Timestamp.IsZero() {
+		s.SetTimestamp(opts.Timestamp)
+	}
+	if opts.UserFlags != 0 {
+		s.SetUserFlags(opts.UserFlags)
+	}
+	if opts.CacheLifetime != 0 {
+		s.SetCacheLifetime(opts.CacheLifetime)
+	}
+}
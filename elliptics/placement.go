@@ -0,0 +1,163 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// GroupCandidate is a group considered for writing given key together with the backend which hosts the key there.
+type GroupCandidate struct {
+	Group   uint32
+	Backend *StatBackend
+
+	// PID pain of the backend, lower is better
+	Pain float64
+
+	// space in bytes which can still be written into the backend
+	Free uint64
+}
+
+// FreeSpace returns number of bytes which can still be written into the backend.
+// It honours blob size limit and available space of the filesystem.
+func (backend *StatBackend) FreeSpace() uint64 {
+	var free uint64
+	if backend.VFS.TotalSizeLimit > backend.VFS.BackendUsedSize {
+		free = backend.VFS.TotalSizeLimit - backend.VFS.BackendUsedSize
+	}
+
+	if backend.VFS.Avail < free {
+		free = backend.VFS.Avail
+	}
+
+	return free
+}
+
+/*
+GroupSelector chooses groups to write a key into using the latest statistics.
+
+For every group the backend which hosts the key is resolved via StatGroup.FindStatBackendKey.
+Groups whose backend is read-only, has an error or does not have enough free space are skipped,
+the rest are ordered by PID pain and then by free space.
+
+Statistics is replaced by Update(), GroupSelector is safe for concurrent use.
+*/
+type GroupSelector struct {
+	session *Session
+
+	// MinFree is the number of bytes which must stay free on the backend after the write
+	MinFree uint64
+
+	// Feedback, if set, provides PID controllers fed with observed write speed to every new statistics
+	Feedback *PIDFeedback
+
+	mutex sync.RWMutex
+	stat  *DnetStat
+}
+
+// NewGroupSelector returns selector which uses @session to find backends hosting keys.
+// Update() must be called before the first selection.
+func NewGroupSelector(session *Session) *GroupSelector {
+	return &GroupSelector{
+		session: session,
+	}
+}
+
+// Update replaces statistics used for selection, PID state of backends is carried over from the previous one.
+func (gs *GroupSelector) Update(stat *DnetStat) {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+
+	stat.Diff(gs.stat)
+	if gs.Feedback != nil {
+		gs.Feedback.Apply(stat)
+	}
+	gs.stat = stat
+}
+
+// Stat returns statistics currently used for selection.
+func (gs *GroupSelector) Stat() *DnetStat {
+	gs.mutex.RLock()
+	defer gs.mutex.RUnlock()
+
+	return gs.stat
+}
+
+// Candidates returns all groups where @size bytes of @key can be written, the best group comes first.
+func (gs *GroupSelector) Candidates(key string, size uint64) []GroupCandidate {
+	gs.mutex.RLock()
+	defer gs.mutex.RUnlock()
+
+	if gs.stat == nil {
+		return nil
+	}
+
+	candidates := make([]GroupCandidate, 0, len(gs.stat.Group))
+	for group, sg := range gs.stat.Group {
+		backend, err := sg.FindStatBackendKey(gs.session, key, group)
+		if err != nil {
+			continue
+		}
+
+		if backend.RO || backend.Error.Code != 0 {
+			continue
+		}
+
+		free := backend.FreeSpace()
+		if free < size+gs.MinFree {
+			continue
+		}
+
+		candidates = append(candidates, GroupCandidate{
+			Group:   group,
+			Backend: backend,
+			Pain:    backend.PIDPain(),
+			Free:    free,
+		})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Pain != candidates[j].Pain {
+			return candidates[i].Pain < candidates[j].Pain
+		}
+		return candidates[i].Free > candidates[j].Free
+	})
+
+	return candidates
+}
+
+// Select returns @n best groups to write @size bytes of @key into.
+// If fewer groups are suitable, they are returned together with -ENOSPC error.
+func (gs *GroupSelector) Select(key string, size uint64, n int) ([]uint32, error) {
+	candidates := gs.Candidates(key, size)
+
+	groups := make([]uint32, 0, n)
+	for i := 0; i < len(candidates) && i < n; i++ {
+		groups = append(groups, candidates[i].Group)
+	}
+
+	if len(groups) < n {
+		return groups, &DnetError{
+			Code:    ErrNoSpace.Code,
+			Flags:   0,
+			Message: fmt.Sprintf("could not select %d groups for key: %s, size: %d: only %d suitable", n, key, size, len(groups)),
+		}
+	}
+
+	return groups, nil
+}
@@ -7,15 +7,23 @@ import (
 )
 
 var (
-	KeyError        = errors.New("No key")
-	counter  uint64 = 0
+	KeyError                     = errors.New("No key")
+	ContextCancelledError        = errors.New("Context cancelled")
+	counter               uint64 = 0
 )
 
-var Pool = contextPool{pool: make(map[uint64]interface{})}
+var Pool = contextPool{
+	pool:      make(map[uint64]interface{}),
+	cancelled: make(map[uint64][]uint64),
+}
 
 type contextPool struct {
 	mutex sync.Mutex
 	pool  map[uint64]interface{}
+
+	// keys of operations cancelled from Go side while C++ request is still in flight,
+	// final key maps to the list of keys which have to be forgotten when final callback arrives
+	cancelled map[uint64][]uint64
 }
 
 func NextContext() uint64 {
@@ -36,6 +44,10 @@ func (p *contextPool) Get(key uint64) (interface{}, error) {
 		return value, nil
 	}
 
+	if _, cancelled := p.cancelled[key]; cancelled {
+		return nil, ContextCancelledError
+	}
+
 	return nil, KeyError
 }
 
@@ -43,4 +55,37 @@ func (p *contextPool) Delete(key uint64) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 	delete(p.pool, key)
+
+	if keys, cancelled := p.cancelled[key]; cancelled {
+		for _, k := range keys {
+			delete(p.pool, k)
+			delete(p.cancelled, k)
+		}
+		delete(p.cancelled, key)
+	}
+}
+
+// Cancel removes callbacks stored under @final and @keys from the pool at once.
+// C++ replies which are still in flight for these keys will get ContextCancelledError from Get(),
+// values stored under @retained (buffers C++ code may still reference) are kept
+// until Delete(@final) is called from the final callback.
+// If @onFinal is not nil, it replaces the final callback, it must call Delete(@final).
+func (p *contextPool) Cancel(final uint64, keys []uint64, retained []uint64, onFinal interface{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	forget := make([]uint64, 0, len(keys)+len(retained))
+	for _, k := range keys {
+		delete(p.pool, k)
+		p.cancelled[k] = nil
+		forget = append(forget, k)
+	}
+	forget = append(forget, retained...)
+
+	if onFinal != nil {
+		p.pool[final] = onFinal
+	} else {
+		delete(p.pool, final)
+	}
+	p.cancelled[final] = forget
 }
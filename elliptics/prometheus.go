@@ -0,0 +1,183 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PrometheusContentType is the content type of Prometheus text exposition format.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type backendMetric struct {
+	name  string
+	help  string
+	value func(sb *StatBackend) float64
+}
+
+func boolMetric(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+var backendMetrics = []backendMetric{
+	{"elliptics_backend_vfs_total_bytes", "Total space of the backend filesystem.",
+		func(sb *StatBackend) float64 { return float64(sb.VFS.Total) }},
+	{"elliptics_backend_vfs_avail_bytes", "Available space of the backend filesystem.",
+		func(sb *StatBackend) float64 { return float64(sb.VFS.Avail) }},
+	{"elliptics_backend_size_limit_bytes", "Logical size limit of the backend.",
+		func(sb *StatBackend) float64 { return float64(sb.VFS.TotalSizeLimit) }},
+	{"elliptics_backend_used_bytes", "Space used by the backend records.",
+		func(sb *StatBackend) float64 { return float64(sb.VFS.BackendUsedSize) }},
+	{"elliptics_backend_removed_bytes", "Space used by removed records of the backend.",
+		func(sb *StatBackend) float64 { return float64(sb.VFS.BackendRemovedSize) }},
+	{"elliptics_backend_records_total", "Number of records in the backend.",
+		func(sb *StatBackend) float64 { return float64(sb.VFS.RecordsTotal) }},
+	{"elliptics_backend_records_removed", "Number of removed records in the backend.",
+		func(sb *StatBackend) float64 { return float64(sb.VFS.RecordsRemoved) }},
+	{"elliptics_backend_records_corrupted", "Number of corrupted records in the backend.",
+		func(sb *StatBackend) float64 { return float64(sb.VFS.RecordsCorrupted) }},
+	{"elliptics_backend_read_only", "Whether the backend is in read-only mode.",
+		func(sb *StatBackend) float64 { return boolMetric(sb.RO) }},
+	{"elliptics_backend_delay_milliseconds", "Delay added to every backend operation.",
+		func(sb *StatBackend) float64 { return float64(sb.Delay) }},
+	{"elliptics_backend_error_code", "Error code of the backend, 0 if there is no error.",
+		func(sb *StatBackend) float64 { return float64(sb.Error.Code) }},
+	{"elliptics_backend_defrag_state", "Defragmentation state: 0 - not started, 1 - in progress.",
+		func(sb *StatBackend) float64 { return float64(sb.DefragState) }},
+	{"elliptics_backend_ring_ratio", "Part of the group ID ring served by the backend.",
+		func(sb *StatBackend) float64 { return sb.Percentage }},
+	{"elliptics_backend_pid_pain", "Pain of the backend PID controller used for write placement.",
+		func(sb *StatBackend) float64 { return sb.PIDPain() }},
+}
+
+type commandMetric struct {
+	name  string
+	help  string
+	value func(cs *CStat) float64
+}
+
+var commandMetrics = []commandMetric{
+	{"elliptics_backend_command_success_rps", "Successful requests per second of the command.",
+		func(cs *CStat) float64 { return cs.RPSSuccess }},
+	{"elliptics_backend_command_failure_rps", "Failed requests per second of the command.",
+		func(cs *CStat) float64 { return cs.RPSFailures }},
+	{"elliptics_backend_command_bps", "Bytes per second transferred by the command.",
+		func(cs *CStat) float64 { return cs.BPS }},
+}
+
+type labeledBackend struct {
+	labels  string
+	backend *StatBackend
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// sortedBackends returns backends of @stat ordered by group, address and backend id together with their labels.
+func sortedBackends(stat *DnetStat) []labeledBackend {
+	groups := make([]uint32, 0, len(stat.Group))
+	for group := range stat.Group {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i] < groups[j]
+	})
+
+	ret := make([]labeledBackend, 0)
+	for _, group := range groups {
+		backends := make([]*StatBackend, 0, len(stat.Group[group].Ab))
+		for _, sb := range stat.Group[group].Ab {
+			backends = append(backends, sb)
+		}
+		sort.Slice(backends, func(i, j int) bool {
+			ai, aj := backends[i].Ab.Addr.String(), backends[j].Ab.Addr.String()
+			if ai != aj {
+				return ai < aj
+			}
+			return backends[i].Ab.Backend < backends[j].Ab.Backend
+		})
+
+		for _, sb := range backends {
+			ret = append(ret, labeledBackend{
+				labels: fmt.Sprintf(`group="%d",address="%s",backend="%d"`,
+					group, labelEscaper.Replace(sb.Ab.Addr.String()), sb.Ab.Backend),
+				backend: sb,
+			})
+		}
+	}
+
+	return ret
+}
+
+func formatMetricValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WritePrometheus writes per-backend statistics of @stat into @w in Prometheus text exposition format.
+// Every metric is labeled with group, address and backend, command metrics are labeled with command name as well.
+func WritePrometheus(w io.Writer, stat *DnetStat) error {
+	bw := bufio.NewWriter(w)
+	backends := sortedBackends(stat)
+
+	for _, m := range backendMetrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for _, lb := range backends {
+			fmt.Fprintf(bw, "%s{%s} %s\n", m.name, lb.labels, formatMetricValue(m.value(lb.backend)))
+		}
+	}
+
+	for _, m := range commandMetrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for _, lb := range backends {
+			commands := make([]string, 0, len(lb.backend.Commands))
+			for cmd := range lb.backend.Commands {
+				commands = append(commands, cmd)
+			}
+			sort.Strings(commands)
+
+			for _, cmd := range commands {
+				fmt.Fprintf(bw, "%s{%s,command=\"%s\"} %s\n", m.name, lb.labels, labelEscaper.Replace(cmd),
+					formatMetricValue(m.value(lb.backend.Commands[cmd])))
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// NewPrometheusHandler returns HTTP handler which exports statistics returned by @latest,
+// for example StatMonitor.Latest, in Prometheus text exposition format.
+// If there are no statistics yet, handler replies with 503 Service Unavailable.
+func NewPrometheusHandler(latest func() *DnetStat) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stat := latest()
+		if stat == nil {
+			http.Error(w, "no statistics collected yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", PrometheusContentType)
+		WritePrometheus(w, stat)
+	})
+}
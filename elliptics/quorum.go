@@ -0,0 +1,198 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// QuorumOptions controls PutQuorum.
+type QuorumOptions struct {
+	// Required is the number of groups which have to accept the data, zero means all groups
+	Required int
+
+	// RemovePartial removes the key from groups which have accepted the data when quorum has not been reached
+	RemovePartial bool
+}
+
+// QuorumResult is a summary of the quorum write.
+type QuorumResult struct {
+	// Required is the number of successful groups needed for the quorum
+	Required int
+
+	// Succeeded and Failed contain outcome of the write in every group,
+	// groups which have not replied at all are reported as failed
+	Succeeded []GroupResult
+	Failed    []GroupResult
+
+	// Removed contains outcome of partial copies removal, it is empty unless
+	// quorum has been missed and QuorumOptions.RemovePartial is set
+	Removed []GroupResult
+}
+
+// Reached returns true if enough groups have accepted the data.
+func (r *QuorumResult) Reached() bool {
+	return len(r.Succeeded) >= r.Required
+}
+
+// QuorumError is returned by PutQuorum when less than required number of groups have accepted the data.
+type QuorumError struct {
+	Required  int
+	Succeeded int
+
+	// Err is MultiError with failures of all groups
+	Err error
+}
+
+func (e *QuorumError) Error() string {
+	return fmt.Sprintf("quorum write failed: %d of %d required groups succeeded: %v",
+		e.Succeeded, e.Required, e.Err)
+}
+
+func (e *QuorumError) Unwrap() error {
+	return e.Err
+}
+
+// PutQuorum writes @size bytes from @input and fails unless at least @opts.Required groups have accepted them.
+// Required number of groups greater than the number of groups the data is written to is an error,
+// as well as empty list of groups, nothing is written then.
+func (c *Client) PutQuorum(key string, input io.Reader, size uint64, opts QuorumOptions) (*QuorumResult, error) {
+	return c.PutQuorumCtx(context.Background(), key, input, size, opts)
+}
+
+// PutQuorumCtx is a PutQuorum which gives up when @ctx is done.
+//
+// Removal of partial copies is not bound to @ctx, otherwise it would never run
+// when the quorum has been missed because of the context deadline.
+func (c *Client) PutQuorumCtx(ctx context.Context, key string, input io.Reader, size uint64, opts QuorumOptions,
+	options ...CallOption) (*QuorumResult, error) {
+	callOpts := callOptions(options)
+
+	groups := c.session.GetGroups()
+	if callOpts != nil && len(callOpts.Groups) != 0 {
+		groups = callOpts.Groups
+	}
+
+	if len(groups) == 0 {
+		return nil, &DnetError{
+			Code:    ErrNoGroups.Code,
+			Flags:   0,
+			Message: "quorum write: no groups to write to",
+		}
+	}
+
+	required := opts.Required
+	if required < 0 || required > len(groups) {
+		return nil, &DnetError{
+			Code:    -22, // -EINVAL
+			Flags:   0,
+			Message: fmt.Sprintf("quorum of %d groups can not be reached with %d groups", required, len(groups)),
+		}
+	}
+	if required == 0 {
+		required = len(groups)
+	}
+
+	session, err := CloneSession(c.session)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Delete()
+	session.SetFilter(SessionFilterAll)
+
+	results, errs, _ := collectWrites(session.WriteDataCtx(ctx, key, input, 0, size, options...))
+
+	res := &QuorumResult{
+		Required:  required,
+		Succeeded: make([]GroupResult, 0, len(groups)),
+		Failed:    make([]GroupResult, 0),
+	}
+
+	replied := make(map[uint32]bool, len(results))
+	for _, r := range results {
+		replied[r.Group] = true
+
+		if r.Err == nil {
+			res.Succeeded = append(res.Succeeded, r)
+		} else {
+			res.Failed = append(res.Failed, r)
+		}
+	}
+
+	for _, group := range groups {
+		if replied[group] {
+			continue
+		}
+
+		err := &DnetError{
+			Code:    ErrTimeout.Code,
+			Flags:   0,
+			Message: fmt.Sprintf("no reply from group %d", group),
+		}
+		res.Failed = append(res.Failed, GroupResult{
+			Group:  group,
+			Status: int32(err.Code),
+			Err:    err,
+		})
+		errs.add(group, nil, 0, err)
+	}
+
+	if res.Reached() {
+		return res, nil
+	}
+
+	if opts.RemovePartial && len(res.Succeeded) != 0 {
+		res.Removed = c.removePartial(callOpts, key, res.Succeeded)
+	}
+
+	return res, &QuorumError{
+		Required:  required,
+		Succeeded: len(res.Succeeded),
+		Err:       errs.failure(),
+	}
+}
+
+// removePartial removes @key from groups which have accepted it during failed quorum write.
+func (c *Client) removePartial(callOpts *CallOptions, key string, written []GroupResult) []GroupResult {
+	opts := callOpts.clone()
+	opts.Groups = make([]uint32, 0, len(written))
+	for _, w := range written {
+		opts.Groups = append(opts.Groups, w.Group)
+	}
+
+	removed := make([]GroupResult, 0, len(written))
+	for rm := range c.session.RemoveCtx(context.Background(), key, opts.option()) {
+		err := rm.Error()
+		if err == nil && rm.Cmd().Status != 0 {
+			err = &DnetError{
+				Code:    int(rm.Cmd().Status),
+				Flags:   rm.Cmd().Flags,
+				Message: fmt.Sprintf("remove failed in group %d", rm.Cmd().ID.Group),
+			}
+		}
+
+		removed = append(removed, GroupResult{
+			Group:   rm.Cmd().ID.Group,
+			Backend: rm.Cmd().Backend,
+			Status:  rm.Cmd().Status,
+			Err:     err,
+		})
+	}
+
+	return removed
+}
@@ -1,6 +1,7 @@
 package elliptics
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"time"
@@ -114,22 +115,21 @@ func (r *ReadSeeker) ReadInternal(buf []byte) (n int, err error) {
 		return 0, fmt.Errorf("trying to read from empty interface")
 	}
 
-	ioflags := r.session.GetIOflags()
-	defer r.session.SetIOflags(ioflags)
-
-	errors := make([]error, 0)
+	errs := &MultiError{}
 
 	// if we have already read at least some data and this object doesn't have chunked checksum
 	// disable checksum verification, since the first call has already checked the whole file
+	// flag is set for this call only, session can be shared with other readers
+	var options []CallOption
 	if r.TotalSize != 0 && (r.RecordFlags & DNET_RECORD_FLAGS_CHUNKED_CSUM) == 0 {
-		r.session.SetIOflags(r.session.GetIOflags() | DNET_IO_FLAGS_NOCSUM)
+		options = append(options, WithIOflags(DNET_IO_FLAGS_NOCSUM))
 	}
 
 	r.read_offset = uint64(r.offset)
-	for rd := range r.session.ReadInto(r.key, r.read_offset, buf) {
+	for rd := range r.session.ReadIntoCtx(context.Background(), r.key, r.read_offset, buf, options...) {
 		err = rd.Error()
 		if err != nil {
-			errors = append(errors, err)
+			errs.add(rd.Cmd().ID.Group, rd.Addr(), rd.Cmd().Backend, err)
 			continue
 		}
 
@@ -144,22 +144,12 @@ func (r *ReadSeeker) ReadInternal(buf []byte) (n int, err error) {
 		return int(r.read_size), nil
 	}
 
-	code := -6
-	if len(errors) != 0 {
-		for _, err = range errors {
-			code = ErrorCode(err)
-			if code != -110 {
-				break
-			}
-		}
-	}
-
 	return 0, &DnetError {
-		Code:  code,
+		Code:  ErrorCode(errs.failure()),
 		Flags: 0,
 		Message: fmt.Sprintf(
 			"read-seeker error: current-offset: %d, total-size: %d, errors: %v",
-			r.offset, r.TotalSize, errors),
+			r.offset, r.TotalSize, errs.errs()),
 	}
 }
 
@@ -0,0 +1,517 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RemoteState is the state of connection to one server.
+type RemoteState struct {
+	// Addr is "ip:port:family" of the server or the remote itself if it could not be resolved
+	Addr string
+
+	// Remote is the address passed to AddRemote/AddRemotes which resolved into Addr,
+	// it is empty for servers learnt from the route table
+	Remote string
+
+	Connected bool
+
+	// time connection has been noticed and time it has been lost
+	ConnectedAt    time.Time
+	DisconnectedAt time.Time
+
+	// groups and number of backends served by the server according to the route table
+	Groups   []uint32
+	Backends int
+
+	// time and error of the latest attempt to connect
+	LastAttempt time.Time
+	LastError   error
+}
+
+type ConnectionEventType int
+
+const (
+	RemoteConnected ConnectionEventType = iota
+	RemoteDisconnected
+)
+
+var ConnectionEventTypeString = map[ConnectionEventType]string{
+	RemoteConnected:    "connected",
+	RemoteDisconnected: "disconnected",
+}
+
+func (t ConnectionEventType) String() string {
+	return ConnectionEventTypeString[t]
+}
+
+// ConnectionEvent is sent when connection to the server appears or disappears.
+type ConnectionEvent struct {
+	Type   ConnectionEventType
+	Addr   string
+	Remote string
+	Time   time.Time
+}
+
+// errRemoteNotConnected is recorded for the address which is not connected although adding its remote has succeeded
+var errRemoteNotConnected = fmt.Errorf("not connected")
+
+type remoteAttempt struct {
+	at  time.Time
+	err error
+}
+
+// nodeRemotes tracks remotes added to the node and connection states, it is safe for concurrent use.
+type nodeRemotes struct {
+	mutex       sync.Mutex
+	remotes     map[string]*remoteAttempt
+	states      map[string]*RemoteState
+	subscribers map[chan ConnectionEvent]struct{}
+
+	// stops health check goroutine
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newNodeRemotes() *nodeRemotes {
+	return &nodeRemotes{
+		remotes:     make(map[string]*remoteAttempt),
+		states:      make(map[string]*RemoteState),
+		subscribers: make(map[chan ConnectionEvent]struct{}),
+	}
+}
+
+// attempt records result of the connection to @addr resolved from @remote, @addr is empty if resolution has failed.
+func (r *nodeRemotes) attempt(remote, addr string, err error, now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.remotes[remote] = &remoteAttempt{
+		at:  now,
+		err: err,
+	}
+
+	if addr == "" {
+		return
+	}
+
+	st, ok := r.states[addr]
+	if !ok {
+		st = &RemoteState{Addr: addr}
+		r.states[addr] = st
+	}
+	st.Remote = remote
+	st.LastAttempt = now
+	st.LastError = err
+}
+
+// link marks connected server @addr as resolved from @remote.
+func (r *nodeRemotes) link(remote, addr string, now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.remotes[remote]; !ok {
+		r.remotes[remote] = &remoteAttempt{at: now}
+	}
+
+	if st, ok := r.states[addr]; ok {
+		st.Remote = remote
+	}
+}
+
+func (r *nodeRemotes) configured() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ret := make([]string, 0, len(r.remotes))
+	for remote := range r.remotes {
+		ret = append(ret, remote)
+	}
+
+	return ret
+}
+
+func (r *nodeRemotes) connected() map[string]bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ret := make(map[string]bool)
+	for addr, st := range r.states {
+		if st.Connected {
+			ret[addr] = true
+		}
+	}
+
+	return ret
+}
+
+// update applies current route table and notifies subscribers about connection changes.
+func (r *nodeRemotes) update(routed map[string]*RemoteState, now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	events := make([]ConnectionEvent, 0)
+
+	for addr, rs := range routed {
+		st, ok := r.states[addr]
+		if !ok {
+			st = &RemoteState{Addr: addr}
+			r.states[addr] = st
+		}
+
+		if !st.Connected {
+			st.Connected = true
+			st.ConnectedAt = now
+			st.LastError = nil
+			events = append(events, ConnectionEvent{
+				Type:   RemoteConnected,
+				Addr:   addr,
+				Remote: st.Remote,
+				Time:   now,
+			})
+		}
+		st.Groups = rs.Groups
+		st.Backends = rs.Backends
+	}
+
+	for addr, st := range r.states {
+		if _, ok := routed[addr]; ok || !st.Connected {
+			continue
+		}
+
+		st.Connected = false
+		st.DisconnectedAt = now
+		st.Groups = nil
+		st.Backends = 0
+		events = append(events, ConnectionEvent{
+			Type:   RemoteDisconnected,
+			Addr:   addr,
+			Remote: st.Remote,
+			Time:   now,
+		})
+	}
+
+	for _, ev := range events {
+		for ch := range r.subscribers {
+			// slow subscribers miss events instead of blocking the node
+			select {
+			case ch <- ev:
+			default:
+			}
+		}
+	}
+}
+
+func (r *nodeRemotes) snapshot() []RemoteState {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	resolved := make(map[string]bool)
+	ret := make([]RemoteState, 0, len(r.states))
+	for _, st := range r.states {
+		tmp := *st
+		tmp.Groups = append([]uint32(nil), st.Groups...)
+		ret = append(ret, tmp)
+		resolved[st.Remote] = true
+	}
+
+	// remotes which have never been resolved or connected
+	for remote, a := range r.remotes {
+		if resolved[remote] {
+			continue
+		}
+		if _, ok := r.states[remote]; ok {
+			continue
+		}
+
+		ret = append(ret, RemoteState{
+			Addr:        remote,
+			Remote:      remote,
+			LastAttempt: a.at,
+			LastError:   a.err,
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Addr < ret[j].Addr
+	})
+
+	return ret
+}
+
+// routeStates returns servers present in the route table of the node.
+func (node *Node) routeStates() (map[string]*RemoteState, error) {
+	session, err := NewSession(node)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Delete()
+
+	stat := &DnetStat{
+		Group: make(map[uint32]*StatGroup),
+	}
+	session.GetRoutes(stat)
+
+	ret := make(map[string]*RemoteState)
+	for group, sg := range stat.Group {
+		for ab := range sg.Ab {
+			addr := ab.Addr.String()
+
+			st, ok := ret[addr]
+			if !ok {
+				st = &RemoteState{Addr: addr}
+				ret[addr] = st
+			}
+
+			st.Backends++
+
+			has := false
+			for _, g := range st.Groups {
+				has = has || g == group
+			}
+			if !has {
+				st.Groups = append(st.Groups, group)
+			}
+		}
+	}
+
+	for _, st := range ret {
+		sort.Slice(st.Groups, func(i, j int) bool {
+			return st.Groups[i] < st.Groups[j]
+		})
+	}
+
+	return ret, nil
+}
+
+// States returns states of connections to all servers the node knows about: connected ones from the route table
+// and those added by AddRemote/AddRemotes. Subscribers of ConnectionEvents are notified about changes noticed.
+func (node *Node) States() ([]RemoteState, error) {
+	routed, err := node.routeStates()
+	if err != nil {
+		return nil, err
+	}
+
+	node.remotes.update(routed, time.Now())
+	return node.remotes.snapshot(), nil
+}
+
+// ConnectionEvents returns channel which receives connect and disconnect events, up to @buffer events are queued
+// and newer ones are dropped if the subscriber does not keep up.
+// Changes are noticed by AddRemote/AddRemotes, States() and by the health check (see StartHealthCheck).
+// Returned function unsubscribes and closes the channel.
+func (node *Node) ConnectionEvents(buffer int) (<-chan ConnectionEvent, func()) {
+	r := node.remotes
+	ch := make(chan ConnectionEvent, buffer)
+
+	r.mutex.Lock()
+	r.subscribers[ch] = struct{}{}
+	r.mutex.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+
+			if _, ok := r.subscribers[ch]; ok {
+				delete(r.subscribers, ch)
+				close(ch)
+			}
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+// splitRemote splits @remote (host:port or host:port:family) into its parts, family is 0 if it is omitted.
+// Remote is parsed from the right, since IPv6 host contains colons itself.
+func splitRemote(remote string) (host, port string, family int, err error) {
+	parts := strings.Split(remote, ":")
+	if len(parts) < 2 {
+		return "", "", 0, fmt.Errorf("invalid remote: %s", remote)
+	}
+
+	if len(parts) > 2 {
+		// server addresses carry route group after the family, e.g. localhost:1025:2-0
+		f := parts[len(parts)-1]
+		if i := strings.IndexByte(f, '-'); i > 0 {
+			f = f[:i]
+		}
+		if f == "2" || f == "10" {
+			family, _ = strconv.Atoi(f)
+			parts = parts[:len(parts)-1]
+		}
+	}
+
+	port = parts[len(parts)-1]
+	host = strings.Join(parts[:len(parts)-1], ":")
+	return host, port, family, nil
+}
+
+// resolveRemote resolves host of @remote (host:port or host:port:family) and returns "ip:port:family" addresses.
+func resolveRemote(remote string) ([]string, error) {
+	host, port, family, err := splitRemote(remote)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		if ips, err = net.LookupIP(host); err != nil {
+			return nil, err
+		}
+	}
+
+	ret := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		f := 10
+		if ip.To4() != nil {
+			f = 2
+		}
+		if family != 0 && family != f {
+			continue
+		}
+
+		ret = append(ret, fmt.Sprintf("%s:%s:%d", ip.String(), port, f))
+	}
+
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no addresses of family %d for remote: %s", family, remote)
+	}
+
+	return ret, nil
+}
+
+// remotesAdded records result @err of adding @remotes to the node. Remotes are resolved and linked
+// to their connected addresses, so that every server is reported once by States().
+// Addresses which are not connected get @err or errRemoteNotConnected if the batch has succeeded,
+// they are not dialed again here, reconnects are left to the health check.
+func (node *Node) remotesAdded(remotes []string, err error) {
+	now := time.Now()
+	if routed, rerr := node.routeStates(); rerr == nil {
+		node.remotes.update(routed, now)
+	}
+	connected := node.remotes.connected()
+
+	failed := err
+	if failed == nil {
+		failed = errRemoteNotConnected
+	}
+
+	for _, remote := range remotes {
+		addrs, rerr := resolveRemote(remote)
+		if rerr != nil {
+			if err != nil {
+				// client library has its own opinion on why the remote is unusable
+				rerr = err
+			}
+			node.remotes.attempt(remote, "", rerr, now)
+			continue
+		}
+
+		for _, addr := range addrs {
+			if connected[addr] {
+				node.remotes.link(remote, addr, now)
+				continue
+			}
+
+			node.remotes.attempt(remote, addr, failed, now)
+		}
+	}
+}
+
+// retryRemotes connects to the addresses of the added remotes which are not connected,
+// hostnames are resolved again every time.
+func (node *Node) retryRemotes() {
+	connected := node.remotes.connected()
+
+	for _, remote := range node.remotes.configured() {
+		now := time.Now()
+
+		addrs, err := resolveRemote(remote)
+		if err != nil {
+			node.remotes.attempt(remote, "", err, now)
+			continue
+		}
+
+		for _, addr := range addrs {
+			if connected[addr] {
+				node.remotes.link(remote, addr, now)
+				continue
+			}
+
+			node.remotes.attempt(remote, addr, node.addRemote(addr), now)
+		}
+	}
+}
+
+// StartHealthCheck starts goroutine which every @interval refreshes connection states (see States)
+// and reconnects to added remotes which are not connected, including new addresses of their hostnames.
+// Remotes which were down when the node started are connected as soon as they are up.
+// Health check is stopped by StopHealthCheck or Free.
+func (node *Node) StartHealthCheck(interval time.Duration) {
+	node.StopHealthCheck()
+
+	r := node.remotes
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r.mutex.Lock()
+	r.cancel = cancel
+	r.mutex.Unlock()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			node.States()
+			node.retryRemotes()
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// StopHealthCheck stops health check started by StartHealthCheck and waits for it to exit.
+func (node *Node) StopHealthCheck() {
+	r := node.remotes
+
+	r.mutex.Lock()
+	cancel := r.cancel
+	r.cancel = nil
+	r.mutex.Unlock()
+
+	if cancel != nil {
+		cancel()
+		r.wg.Wait()
+	}
+}
@@ -0,0 +1,224 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+)
+
+// RepairReport describes what has been done by read-repair of one key.
+type RepairReport struct {
+	Key string
+
+	// Source is the freshest replica the data has been copied from
+	Source ObjectInfo
+
+	// Stale contains groups where the key has been missing or older than the source
+	Stale []uint32
+
+	// Repaired contains outcome of the rewrite in every stale group
+	Repaired []GroupResult
+
+	// Unavailable contains groups which have failed the lookup with an error other than -ENOENT,
+	// their state is unknown and they are not touched
+	Unavailable []GroupResult
+
+	// Err is set when the repair has not been completed
+	Err error
+}
+
+// isStale returns true if @replica has to be rewritten from @source.
+func isStale(replica, source *ObjectInfo) bool {
+	return replica.Mtime.Before(source.Mtime) ||
+		(replica.Mtime.Equal(source.Mtime) && replica.Size != source.Size)
+}
+
+// Repair finds groups where @key is missing or older than the freshest replica and rewrites them.
+func (c *Client) Repair(key string) *RepairReport {
+	return c.RepairCtx(context.Background(), key)
+}
+
+// RepairCtx is a Repair which gives up when @ctx is done.
+func (c *Client) RepairCtx(ctx context.Context, key string, options ...CallOption) *RepairReport {
+	report := &RepairReport{
+		Key:         key,
+		Stale:       make([]uint32, 0),
+		Repaired:    make([]GroupResult, 0),
+		Unavailable: make([]GroupResult, 0),
+	}
+
+	// negative replies are needed to find groups where the key is missing
+	session, err := CloneSession(c.session)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+	defer session.Delete()
+	session.SetFilter(SessionFilterAll)
+
+	replicas := make([]ObjectInfo, 0)
+	missing := make([]uint32, 0)
+	errs := &MultiError{}
+
+	for l := range session.ParallelLookupCtx(ctx, key, options...) {
+		err := l.Error()
+		if err == nil {
+			replicas = append(replicas, newObjectInfoLookup(l))
+			continue
+		}
+
+		errs.add(l.Cmd().ID.Group, l.Addr(), l.Cmd().Backend, err)
+
+		// overall operation error has no server reply attached
+		if l.Cmd().ID.Group == 0 {
+			continue
+		}
+
+		if errors.Is(err, ErrNotFound) {
+			missing = append(missing, l.Cmd().ID.Group)
+			continue
+		}
+
+		report.Unavailable = append(report.Unavailable, GroupResult{
+			Group:   l.Cmd().ID.Group,
+			Addr:    *l.Addr(),
+			Backend: l.Cmd().Backend,
+			Status:  l.Cmd().Status,
+			Err:     err,
+		})
+	}
+
+	if len(replicas) == 0 {
+		report.Err = errs.failure()
+		return report
+	}
+
+	report.Source = replicas[0]
+	for _, r := range replicas[1:] {
+		if r.Mtime.After(report.Source.Mtime) ||
+			(r.Mtime.Equal(report.Source.Mtime) && r.Size > report.Source.Size) {
+			report.Source = r
+		}
+	}
+
+	report.Stale = append(report.Stale, missing...)
+	for i := range replicas {
+		if isStale(&replicas[i], &report.Source) {
+			report.Stale = append(report.Stale, replicas[i].Group)
+		}
+	}
+
+	if len(report.Stale) == 0 {
+		return report
+	}
+
+	data, info, err := c.GetCtx(ctx, key, withOptions(options, WithGroups(report.Source.Group))...)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+
+	// repaired replicas keep timestamp and user flags of the source,
+	// otherwise they would look fresher than the source itself
+	opts := callOptions(options).clone()
+	opts.Groups = report.Stale
+	opts.Timestamp = info.Mtime
+	opts.UserFlags = info.UserFlags
+
+	results, werrs, good := collectWrites(session.WriteDataCtx(ctx, key,
+		bytes.NewReader(data), 0, uint64(len(data)), opts.option()))
+	report.Repaired = results
+	if good != len(report.Stale) {
+		report.Err = werrs.failure()
+	}
+
+	return report
+}
+
+// Repairer runs read-repair of scheduled keys in background.
+type Repairer struct {
+	client   *Client
+	onReport func(*RepairReport)
+
+	keys chan string
+	wg   sync.WaitGroup
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewRepairer starts @workers goroutines which repair keys passed to Schedule().
+// At most @queue keys wait for repair, @onReport (if not nil) is called with report of every repaired key.
+func NewRepairer(client *Client, workers, queue int, onReport func(*RepairReport)) *Repairer {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	r := &Repairer{
+		client:   client,
+		onReport: onReport,
+		keys:     make(chan string, queue),
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+
+	r.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go r.worker()
+	}
+
+	return r
+}
+
+func (r *Repairer) worker() {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case key := <-r.keys:
+			report := r.client.RepairCtx(r.ctx, key)
+			if r.onReport != nil {
+				r.onReport(report)
+			}
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+// Schedule queues @key for repair, it returns false if the queue is full or repairer has been closed.
+func (r *Repairer) Schedule(key string) bool {
+	select {
+	case <-r.ctx.Done():
+		return false
+	default:
+	}
+
+	select {
+	case r.keys <- key:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops all workers and waits for them to exit, keys left in the queue are not repaired.
+func (r *Repairer) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
@@ -0,0 +1,339 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultRetryBackoff    = 50 * time.Millisecond
+	defaultRetryMultiplier = 2.0
+)
+
+// DefaultRetryableCodes are error codes retried when RetryPolicy.RetryableCodes is empty.
+var DefaultRetryableCodes = []int{
+	-6,   // -ENXIO, no route to the group, usually while its node restarts
+	-11,  // -EAGAIN
+	-32,  // -EPIPE
+	-104, // -ECONNRESET
+	-110, // -ETIMEDOUT
+	-111, // -ECONNREFUSED
+}
+
+// RetryPolicy describes how failed operations are repeated. It is set on the session with SetRetryPolicy()
+// or for a single call with CallOptions.Retry, the policy must not be modified after that.
+//
+// Operations which take string keys (ReadData, WriteData, ParallelLookup and Remove and their ...Ctx variants)
+// honour the policy. Operation is repeated when it has not succeeded in any group and at least one group
+// has failed with a retryable error. Results of the last attempt are returned, they implement Attempter.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, values below 2 disable retries
+	MaxAttempts int
+
+	// Backoff is the delay before the second attempt, it is multiplied by Multiplier
+	// after every attempt, but does not exceed MaxBackoff if it is set.
+	// Zero values mean defaultRetryBackoff and defaultRetryMultiplier
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Multiplier float64
+
+	// Jitter is a fraction (0..1) of every backoff which is randomized
+	Jitter float64
+
+	// RetryableCodes are error codes worth retrying, DefaultRetryableCodes are used if it is empty
+	RetryableCodes []int
+
+	// RetryWrites enables retries of WriteData.
+	// Writes are not retried by default, since failed write may have been applied in some groups.
+	// Input which is not an io.Seeker is buffered in memory to be resent, large chunked writes
+	// of such input are never retried.
+	RetryWrites bool
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	codes := p.RetryableCodes
+	if len(codes) == 0 {
+		codes = DefaultRetryableCodes
+	}
+
+	// errors not coming from elliptics, like context errors, are never retried
+	ke := DnetErrorFromError(err)
+	if ke == nil {
+		return false
+	}
+
+	for _, code := range codes {
+		if ke.Code == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shouldRetry checks errors of all results of one attempt, nil error stands for a successful result.
+func (p *RetryPolicy) shouldRetry(errs []error) bool {
+	retry := false
+	for _, err := range errs {
+		if err == nil {
+			return false
+		}
+		if p.retryable(err) {
+			retry = true
+		}
+	}
+
+	return retry
+}
+
+// backoff returns delay after @attempt-th attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.Backoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = defaultRetryMultiplier
+	}
+
+	d := float64(backoff)
+	for i := 1; i < attempt; i++ {
+		d *= multiplier
+		if p.MaxBackoff > 0 && d >= float64(p.MaxBackoff) {
+			d = float64(p.MaxBackoff)
+			break
+		}
+	}
+
+	if p.Jitter > 0 {
+		d -= d * p.Jitter * rand.Float64()
+	}
+
+	return time.Duration(d)
+}
+
+// run calls @attempt until it succeeds, its failure is not retryable, attempts are exhausted or @ctx is done.
+// @attempt returns errors of all its results. run returns the number of attempts made.
+func (p *RetryPolicy) run(ctx context.Context, attempt func() []error) int {
+	for n := 1; ; n++ {
+		errs := attempt()
+		if n >= p.MaxAttempts || !p.shouldRetry(errs) {
+			return n
+		}
+
+		timer := time.NewTimer(p.backoff(n))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return n
+		case <-timer.C:
+		}
+	}
+}
+
+// SetRetryPolicy sets retry policy of the session, nil disables retries.
+// Cloned sessions share the policy.
+func (s *Session) SetRetryPolicy(policy *RetryPolicy) {
+	s.retry = policy
+}
+
+func (s *Session) GetRetryPolicy() *RetryPolicy {
+	return s.retry
+}
+
+// retryPolicy returns policy which applies to the call with options @opts or nil if it should not be retried.
+func (s *Session) retryPolicy(opts *CallOptions, write bool) *RetryPolicy {
+	policy := s.retry
+	if opts != nil && opts.Retry != nil {
+		policy = opts.Retry
+	}
+
+	if policy == nil || policy.MaxAttempts < 2 || (write && !policy.RetryWrites) {
+		return nil
+	}
+
+	return policy
+}
+
+// Attempter is implemented by results of operations retried according to RetryPolicy.
+type Attempter interface {
+	// Attempts returns the number of attempts made to get the result
+	Attempts() int
+}
+
+// Attempts returns the number of attempts made to get result @r, it is 1 if operation has not been retried.
+func Attempts(r interface{}) int {
+	if a, ok := r.(Attempter); ok {
+		return a.Attempts()
+	}
+
+	return 1
+}
+
+type retriedRead struct {
+	ReadResult
+	attempts int
+}
+
+func (r *retriedRead) Attempts() int {
+	return r.attempts
+}
+
+type retriedLookup struct {
+	Lookuper
+	attempts int
+}
+
+func (r *retriedLookup) Attempts() int {
+	return r.attempts
+}
+
+type retriedRemove struct {
+	Remover
+	attempts int
+}
+
+func (r *retriedRemove) Attempts() int {
+	return r.attempts
+}
+
+// retryRead runs @call according to retry policy, @call is invoked from another goroutine if retries are enabled.
+func (s *Session) retryRead(ctx context.Context, opts *CallOptions, call func() <-chan ReadResult) <-chan ReadResult {
+	policy := s.retryPolicy(opts, false)
+	if policy == nil {
+		return call()
+	}
+
+	responseCh := make(chan ReadResult, defaultVOLUME)
+	go func() {
+		defer close(responseCh)
+
+		var results []ReadResult
+		attempts := policy.run(ctx, func() []error {
+			results = make([]ReadResult, 0)
+			errs := make([]error, 0)
+			for r := range call() {
+				results = append(results, r)
+				errs = append(errs, r.Error())
+			}
+			return errs
+		})
+
+		for _, r := range results {
+			responseCh <- &retriedRead{r, attempts}
+		}
+	}()
+
+	return responseCh
+}
+
+// retryLookup is a retryRead for write and lookup operations.
+func (s *Session) retryLookup(ctx context.Context, opts *CallOptions, write bool, call func() <-chan Lookuper) <-chan Lookuper {
+	policy := s.retryPolicy(opts, write)
+	if policy == nil {
+		return call()
+	}
+
+	responseCh := make(chan Lookuper, defaultVOLUME)
+	go func() {
+		defer close(responseCh)
+
+		var results []Lookuper
+		attempts := policy.run(ctx, func() []error {
+			results = make([]Lookuper, 0)
+			errs := make([]error, 0)
+			for r := range call() {
+				results = append(results, r)
+				errs = append(errs, r.Error())
+			}
+			return errs
+		})
+
+		for _, r := range results {
+			responseCh <- &retriedLookup{r, attempts}
+		}
+	}()
+
+	return responseCh
+}
+
+// retryRemove is a retryRead for remove operations, replies with non-zero status are failures too.
+func (s *Session) retryRemove(ctx context.Context, opts *CallOptions, call func() <-chan Remover) <-chan Remover {
+	policy := s.retryPolicy(opts, false)
+	if policy == nil {
+		return call()
+	}
+
+	responseCh := make(chan Remover, defaultVOLUME)
+	go func() {
+		defer close(responseCh)
+
+		var results []Remover
+		attempts := policy.run(ctx, func() []error {
+			results = make([]Remover, 0)
+			errs := make([]error, 0)
+			for r := range call() {
+				results = append(results, r)
+
+				err := r.Error()
+				if err == nil && r.Cmd().Status != 0 {
+					err = &DnetError{
+						Code:  int(r.Cmd().Status),
+						Flags: r.Cmd().Flags,
+					}
+				}
+				errs = append(errs, err)
+			}
+			return errs
+		})
+
+		for _, r := range results {
+			responseCh <- &retriedRemove{r, attempts}
+		}
+	}()
+
+	return responseCh
+}
+
+// rewindableInput returns function which returns @input positioned at its initial offset for every write attempt.
+// It returns nil if @input can not be rewound.
+func rewindableInput(input io.Reader, size uint64) func() (io.Reader, error) {
+	if seeker, ok := input.(io.Seeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err == nil {
+			return func() (io.Reader, error) {
+				_, err := seeker.Seek(start, io.SeekStart)
+				return input, err
+			}
+		}
+	}
+
+	if size > max_chunk_size {
+		return nil
+	}
+
+	data, err := ioutil.ReadAll(input)
+	return func() (io.Reader, error) {
+		return bytes.NewReader(data), err
+	}
+}
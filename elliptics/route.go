@@ -37,6 +37,14 @@ func (entry *RouteEntry) ID() []byte {
 	return entry.id
 }
 
+func (entry *RouteEntry) Group() uint32 {
+	return entry.group
+}
+
+func (entry *RouteEntry) AddressBackend() AddressBackend {
+	return NewAddressBackend(&entry.addr, entry.backend)
+}
+
 func (r *RouteEntry) String() string {
 	return fmt.Sprintf("route entry: %s: group: %d, addr: %s: backend: %d",
 		hex.EncodeToString(r.id), r.group, r.addr.String(), r.backend)
@@ -72,18 +80,24 @@ func go_route_callback(dnet_entry *C.struct_dnet_route_entry, key uint64) {
 		panic("Unable to find session number")
 	}
 
-	stat := context.(*DnetStat)
-	stat.AddRouteEntry(entry)
+	callback := context.(func(*RouteEntry))
+	callback(entry)
 	return
 }
 
-func (s *Session) GetRoutes(stat *DnetStat) {
+// routes calls @callback for every entry of the route table known to the session.
+func (s *Session) routes(callback func(*RouteEntry)) {
 	context := NextContext()
-	Pool.Store(context, stat)
+	Pool.Store(context, callback)
 
 	C.session_get_routes(s.session, C.context_t(context))
-	stat.Finalize()
 
 	Pool.Delete(context)
 	return
 }
+
+func (s *Session) GetRoutes(stat *DnetStat) {
+	s.routes(stat.AddRouteEntry)
+	stat.Finalize()
+	return
+}
@@ -0,0 +1,413 @@
+/*
+ * 2014+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultRouteWatcherInterval = 10 * time.Second
+
+// RouteRange is a part of the group ring served by a single backend: IDs from Start (inclusive) up to End (exclusive).
+// If End is not greater than Start the range wraps around the end of the ring.
+type RouteRange struct {
+	Start []byte
+	End   []byte
+}
+
+func (r RouteRange) String() string {
+	return fmt.Sprintf("[%s, %s)", hex.EncodeToString(r.Start), hex.EncodeToString(r.End))
+}
+
+// Contains returns true if @id belongs to the range.
+func (r RouteRange) Contains(id []byte) bool {
+	if bytes.Compare(r.Start, r.End) < 0 {
+		return bytes.Compare(id, r.Start) >= 0 && bytes.Compare(id, r.End) < 0
+	}
+
+	return bytes.Compare(id, r.Start) >= 0 || bytes.Compare(id, r.End) < 0
+}
+
+/*
+RouteTable is an immutable snapshot of the route table: for every group it keeps the ring of route entries
+sorted by ID and the ID ranges served by every address+backend.
+
+A key belongs to the entry with the greatest ID not greater than the key's ID, keys below the first entry
+belong to the last one, this is the same rule the server-side route table uses.
+*/
+type RouteTable struct {
+	Time time.Time
+
+	rings  map[uint32][]*RouteEntry
+	ranges map[uint32]map[AddressBackend][]RouteRange
+}
+
+// NewRouteTable builds route table snapshot from @entries, duplicate entries are ignored.
+func NewRouteTable(entries []*RouteEntry) *RouteTable {
+	t := &RouteTable{
+		Time:   time.Now(),
+		rings:  make(map[uint32][]*RouteEntry),
+		ranges: make(map[uint32]map[AddressBackend][]RouteRange),
+	}
+
+	for _, entry := range entries {
+		t.rings[entry.group] = append(t.rings[entry.group], entry)
+	}
+
+	for group, ring := range t.rings {
+		sort.SliceStable(ring, func(i, j int) bool {
+			return bytes.Compare(ring[i].id, ring[j].id) < 0
+		})
+
+		uniq := ring[:0]
+		for _, entry := range ring {
+			if len(uniq) > 0 && bytes.Equal(uniq[len(uniq)-1].id, entry.id) {
+				continue
+			}
+			uniq = append(uniq, entry)
+		}
+		t.rings[group] = uniq
+
+		ranges := make(map[AddressBackend][]RouteRange)
+		for i, entry := range uniq {
+			ab := entry.AddressBackend()
+			ranges[ab] = append(ranges[ab], RouteRange{
+				Start: entry.id,
+				End:   uniq[(i+1)%len(uniq)].id,
+			})
+		}
+		t.ranges[group] = ranges
+	}
+
+	return t
+}
+
+// RouteTable requests route table known to the session and returns its snapshot.
+func (s *Session) RouteTable() *RouteTable {
+	var entries []*RouteEntry
+	s.routes(func(entry *RouteEntry) {
+		entries = append(entries, entry)
+	})
+
+	return NewRouteTable(entries)
+}
+
+// KeyID returns ID of @key in the session's namespace, it can be used for RouteTable.Lookup.
+func (s *Session) KeyID(key string) ([]byte, error) {
+	return hex.DecodeString(s.Transform(key))
+}
+
+// Groups returns sorted list of groups present in the table.
+func (t *RouteTable) Groups() []uint32 {
+	groups := make([]uint32, 0, len(t.rings))
+	for group := range t.rings {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i] < groups[j] })
+
+	return groups
+}
+
+// Ring returns route entries of @group sorted by ID, the slice must not be modified.
+func (t *RouteTable) Ring(group uint32) []*RouteEntry {
+	return t.rings[group]
+}
+
+// Backends returns ID ranges of every address+backend of @group.
+func (t *RouteTable) Backends(group uint32) map[AddressBackend][]RouteRange {
+	return t.ranges[group]
+}
+
+// Ranges returns ID ranges served by @ab in @group, ranges are sorted by Start.
+func (t *RouteTable) Ranges(group uint32, ab AddressBackend) []RouteRange {
+	return t.ranges[group][ab]
+}
+
+// Lookup returns route entry responsible for @id in @group or nil if there is no such group in the table.
+func (t *RouteTable) Lookup(group uint32, id []byte) *RouteEntry {
+	ring := t.rings[group]
+	if len(ring) == 0 {
+		return nil
+	}
+
+	idx := sort.Search(len(ring), func(i int) bool {
+		return bytes.Compare(ring[i].id, id) > 0
+	})
+	if idx == 0 {
+		idx = len(ring)
+	}
+
+	return ring[idx-1]
+}
+
+type RouteEventType int
+
+const (
+	// address+backend appeared in the group
+	RouteJoin RouteEventType = iota
+	// address+backend disappeared from the group
+	RouteLeave
+	// ranges served by address+backend have changed
+	RouteMove
+)
+
+var RouteEventTypeString = map[RouteEventType]string{
+	RouteJoin:  "join",
+	RouteLeave: "leave",
+	RouteMove:  "move",
+}
+
+func (t RouteEventType) String() string {
+	return RouteEventTypeString[t]
+}
+
+// RouteEvent describes change of a single address+backend in a group between two route table snapshots.
+type RouteEvent struct {
+	Type    RouteEventType
+	Group   uint32
+	Backend AddressBackend
+
+	// ranges served before and after the change, Previous is empty for join and Ranges is empty for leave
+	Previous []RouteRange
+	Ranges   []RouteRange
+}
+
+func (e *RouteEvent) String() string {
+	return fmt.Sprintf("route %s: group: %d, %s, ranges: %d -> %d",
+		e.Type, e.Group, e.Backend.String(), len(e.Previous), len(e.Ranges))
+}
+
+func equalRouteRanges(a, b []RouteRange) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !bytes.Equal(a[i].Start, b[i].Start) || !bytes.Equal(a[i].End, b[i].End) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Diff returns changes from @prev to @t, nil @prev is treated as an empty table.
+// Events are ordered by group, leaves go before moves and joins within a group.
+func (t *RouteTable) Diff(prev *RouteTable) []RouteEvent {
+	if prev == nil {
+		prev = NewRouteTable(nil)
+	}
+
+	groups := make(map[uint32]struct{})
+	for group := range t.ranges {
+		groups[group] = struct{}{}
+	}
+	for group := range prev.ranges {
+		groups[group] = struct{}{}
+	}
+
+	sorted := make([]uint32, 0, len(groups))
+	for group := range groups {
+		sorted = append(sorted, group)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var events []RouteEvent
+	for _, group := range sorted {
+		var leaves, changes []RouteEvent
+
+		for ab, ranges := range prev.ranges[group] {
+			if _, ok := t.ranges[group][ab]; !ok {
+				leaves = append(leaves, RouteEvent{
+					Type:     RouteLeave,
+					Group:    group,
+					Backend:  ab,
+					Previous: ranges,
+				})
+			}
+		}
+
+		for ab, ranges := range t.ranges[group] {
+			previous, ok := prev.ranges[group][ab]
+			if !ok {
+				changes = append(changes, RouteEvent{
+					Type:    RouteJoin,
+					Group:   group,
+					Backend: ab,
+					Ranges:  ranges,
+				})
+			} else if !equalRouteRanges(previous, ranges) {
+				changes = append(changes, RouteEvent{
+					Type:     RouteMove,
+					Group:    group,
+					Backend:  ab,
+					Previous: previous,
+					Ranges:   ranges,
+				})
+			}
+		}
+
+		// map iteration order is random, keep events stable
+		less := func(events []RouteEvent) func(i, j int) bool {
+			return func(i, j int) bool {
+				if events[i].Type != events[j].Type {
+					return events[i].Type > events[j].Type
+				}
+				return events[i].Backend.String() < events[j].Backend.String()
+			}
+		}
+		sort.Slice(leaves, less(leaves))
+		sort.Slice(changes, less(changes))
+
+		events = append(events, leaves...)
+		events = append(events, changes...)
+	}
+
+	return events
+}
+
+/*
+RouteWatcher polls route table in background every interval and emits events for every change
+between consecutive snapshots. It can be used to detect topology changes and to invalidate client-side caches.
+
+The first snapshot is used as a baseline and does not produce events.
+*/
+type RouteWatcher struct {
+	session  *Session
+	interval time.Duration
+
+	mutex       sync.RWMutex
+	latest      *RouteTable
+	subscribers map[chan RouteEvent]struct{}
+
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewRouteWatcher starts polling route table through @session every @interval.
+// The first snapshot is requested immediately.
+func NewRouteWatcher(session *Session, interval time.Duration) *RouteWatcher {
+	if interval <= 0 {
+		interval = defaultRouteWatcherInterval
+	}
+
+	w := &RouteWatcher{
+		session:     session,
+		interval:    interval,
+		subscribers: make(map[chan RouteEvent]struct{}),
+	}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+
+	w.wg.Add(1)
+	go w.loop()
+
+	return w
+}
+
+func (w *RouteWatcher) loop() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.poll()
+
+		select {
+		case <-ticker.C:
+		case <-w.ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *RouteWatcher) poll() {
+	table := w.session.RouteTable()
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	prev := w.latest
+	w.latest = table
+	if prev == nil {
+		return
+	}
+
+	for _, event := range table.Diff(prev) {
+		for ch := range w.subscribers {
+			// slow subscribers miss events instead of blocking the watcher
+			select {
+			case ch <- event:
+			default:
+			}
+		}
+	}
+}
+
+// Latest returns the latest route table snapshot or nil if none has been collected yet.
+func (w *RouteWatcher) Latest() *RouteTable {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	return w.latest
+}
+
+// Subscribe returns channel which receives route events, up to @buffer events are queued
+// and newer ones are dropped if the subscriber does not keep up.
+// Returned function unsubscribes and closes the channel.
+func (w *RouteWatcher) Subscribe(buffer int) (<-chan RouteEvent, func()) {
+	ch := make(chan RouteEvent, buffer)
+
+	w.mutex.Lock()
+	w.subscribers[ch] = struct{}{}
+	w.mutex.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			w.mutex.Lock()
+			defer w.mutex.Unlock()
+
+			if _, ok := w.subscribers[ch]; ok {
+				delete(w.subscribers, ch)
+				close(ch)
+			}
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+// Close stops polling and closes all subscription channels.
+func (w *RouteWatcher) Close() {
+	w.cancel()
+	w.wg.Wait()
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for ch := range w.subscribers {
+		delete(w.subscribers, ch)
+		close(ch)
+	}
+}
@@ -15,6 +15,7 @@
 
 #include "session.h"
 #include <errno.h>
+#include <string.h>
 
 using namespace ioremap;
 namespace ph = std::placeholders;
@@ -52,7 +53,11 @@ ell_session *new_elliptics_session(ell_node *node)
 
 ell_session *clone_session(ell_session *session)
 {
-	return new elliptics::session(*session);
+	// copy constructor shares session data with the original session,
+	// clone() creates an independent copy which can be modified without touching the original one
+	ell_session *clone = new elliptics::session(session->clone());
+	clone->set_exceptions_policy(elliptics::session::no_exceptions);
+	return clone;
 }
 
 
@@ -106,6 +111,26 @@ trace_id_t session_get_trace_id(ell_session *session)
 	return session->get_trace_id();
 }
 
+void session_set_user_flags(ell_session *session, uint64_t user_flags)
+{
+	session->set_user_flags(user_flags);
+}
+
+uint64_t session_get_user_flags(ell_session *session)
+{
+	return session->get_user_flags();
+}
+
+void session_set_cache_lifetime(ell_session *session, uint64_t lifetime)
+{
+	session->set_cache_lifetime(lifetime);
+}
+
+uint64_t session_get_cache_lifetime(ell_session *session)
+{
+	return session->get_cache_lifetime();
+}
+
 void session_set_timestamp(ell_session *session, const struct dnet_time *ts)
 {
 	session->set_timestamp(ts);
@@ -152,7 +177,8 @@ static void on_read(context_t context, context_t buffer, const elliptics::read_r
 		};
 
 		go_read_error(result.command(), result.address(), &err, context);
-	} else {
+	} else if (!result.is_ack()) {
+		// acks carry neither io attribute nor data
 		elliptics::data_pointer data(result.file());
 		go_read_result to_go {
 			result.command(), result.address(),
@@ -214,6 +240,21 @@ void session_write_data(ell_session *session, context_t on_chunk_context,
 				       std::bind(&on_finish, final_context, _1));
 }
 
+void session_write_cas(ell_session *session, context_t on_chunk_context,
+			context_t final_context, ell_key *key, const uint8_t *csum,
+			uint64_t offset, char *data, uint64_t size)
+{
+	using namespace std::placeholders;
+
+	dnet_id old_csum;
+	memset(&old_csum, 0, sizeof(old_csum));
+	memcpy(old_csum.id, csum, DNET_ID_SIZE);
+
+	elliptics::data_pointer tmp = elliptics::data_pointer::from_raw(data, size);
+	session->write_cas(*key, tmp, old_csum, offset).connect(std::bind(&on_lookup, on_chunk_context, _1),
+				       std::bind(&on_finish, final_context, _1));
+}
+
 void session_write_prepare(ell_session *session, context_t on_chunk_context,
 			context_t final_context, ell_key *key,
 			uint64_t offset, uint64_t total_size,
@@ -298,11 +339,165 @@ void session_bulk_remove(ell_session *session, context_t on_chunk_context, conte
 		it->transform(*session);
 	}
 
-	session->set_filter(elliptics::filters::all_with_ack);
-	session->bulk_remove(keys->kk).connect(std::bind(&on_remove, on_chunk_context, _1),
+	// do not change filter of the session which may be shared with other goroutines
+	elliptics::session sess = session->clone();
+	sess.set_exceptions_policy(elliptics::session::no_exceptions);
+	sess.set_filter(elliptics::filters::all_with_ack);
+	sess.bulk_remove(keys->kk).connect(std::bind(&on_remove, on_chunk_context, _1),
 				      std::bind(&on_finish, final_context, _1));
 }
 
+void session_bulk_read(ell_session *session, context_t on_chunk_context, context_t final_context, void *ekeys)
+{
+	using namespace std::placeholders;
+
+	ell_keys *keys = (ell_keys *)ekeys;
+
+	std::vector<dnet_io_attr> ios;
+	ios.reserve(keys->kk.size());
+
+	for (auto it = keys->kk.begin(); it != keys->kk.end(); ++it) {
+		it->transform(*session);
+
+		dnet_io_attr io;
+		memset(&io, 0, sizeof(io));
+		memcpy(io.id, it->raw_id().id, DNET_ID_SIZE);
+		memcpy(io.parent, it->raw_id().id, DNET_ID_SIZE);
+
+		ios.push_back(io);
+	}
+
+	// do not change filter of the session which may be shared with other goroutines
+	elliptics::session sess = session->clone();
+	sess.set_exceptions_policy(elliptics::session::no_exceptions);
+	sess.set_filter(elliptics::filters::all);
+	sess.bulk_read(ios).connect(std::bind(&on_read, on_chunk_context, 0, _1),
+				      std::bind(&on_finish, final_context, _1));
+}
+
+/*
+ * Secondary indexes
+ */
+static void on_index(context_t context, const elliptics::callback_result_entry &result)
+{
+	if (result.error()) {
+		elliptics::error_info einfo = result.error();
+		go_error err {
+			result.error().code(),
+			result.command()->flags,
+			einfo.message().c_str()
+		};
+
+		go_index_error(result.command(), result.address(), &err, context);
+	} else {
+		go_index_result to_go {
+			result.command(), result.address()
+		};
+
+		go_index_callback(&to_go, context);
+	}
+}
+
+static void on_find(context_t context, const elliptics::find_indexes_result_entry &result)
+{
+	std::vector<go_index_entry> entries;
+	entries.reserve(result.indexes.size());
+
+	for (auto it = result.indexes.begin(); it != result.indexes.end(); ++it) {
+		entries.push_back(go_index_entry {
+			&it->index, (const char *)it->data.data(), it->data.size()
+		});
+	}
+
+	go_find_result to_go {
+		&result.id, entries.data(), entries.size()
+	};
+
+	go_find_callback(&to_go, context);
+}
+
+static void on_list(context_t context, const elliptics::index_entry &result)
+{
+	go_index_entry to_go {
+		&result.index, (const char *)result.data.data(), result.data.size()
+	};
+
+	go_list_callback(&to_go, context);
+}
+
+static std::vector<std::string> index_names(const char **indexes, uint64_t count)
+{
+	std::vector<std::string> names;
+	names.reserve(count);
+
+	for (uint64_t i = 0; i < count; ++i) {
+		names.emplace_back(indexes[i]);
+	}
+
+	return names;
+}
+
+static std::vector<elliptics::data_pointer> index_data(const struct go_data_pointer *data, uint64_t count)
+{
+	std::vector<elliptics::data_pointer> datas;
+	datas.reserve(count);
+
+	// data is owned by the caller, it has to be copied
+	for (uint64_t i = 0; i < count; ++i) {
+		datas.emplace_back(elliptics::data_pointer::copy(data[i].data, data[i].size));
+	}
+
+	return datas;
+}
+
+void session_set_indexes(ell_session *session, context_t on_chunk_context, context_t final_context,
+		ell_key *key, const char **indexes, const struct go_data_pointer *data, uint64_t count)
+{
+	session->set_indexes(*key, index_names(indexes, count), index_data(data, count)).connect(
+		std::bind(&on_index, on_chunk_context, ph::_1),
+		std::bind(&on_finish, final_context, ph::_1));
+}
+
+void session_update_indexes(ell_session *session, context_t on_chunk_context, context_t final_context,
+		ell_key *key, const char **indexes, const struct go_data_pointer *data, uint64_t count)
+{
+	session->update_indexes(*key, index_names(indexes, count), index_data(data, count)).connect(
+		std::bind(&on_index, on_chunk_context, ph::_1),
+		std::bind(&on_finish, final_context, ph::_1));
+}
+
+void session_remove_indexes(ell_session *session, context_t on_chunk_context, context_t final_context,
+		ell_key *key, const char **indexes, uint64_t count)
+{
+	session->remove_indexes(*key, index_names(indexes, count)).connect(
+		std::bind(&on_index, on_chunk_context, ph::_1),
+		std::bind(&on_finish, final_context, ph::_1));
+}
+
+void session_find_all_indexes(ell_session *session, context_t on_chunk_context, context_t final_context,
+		const char **indexes, uint64_t count)
+{
+	session->find_all_indexes(index_names(indexes, count)).connect(
+		std::bind(&on_find, on_chunk_context, ph::_1),
+		std::bind(&on_finish, final_context, ph::_1));
+}
+
+void session_find_any_indexes(ell_session *session, context_t on_chunk_context, context_t final_context,
+		const char **indexes, uint64_t count)
+{
+	session->find_any_indexes(index_names(indexes, count)).connect(
+		std::bind(&on_find, on_chunk_context, ph::_1),
+		std::bind(&on_finish, final_context, ph::_1));
+}
+
+void session_list_indexes(ell_session *session, context_t on_chunk_context, context_t final_context,
+		ell_key *key)
+{
+	session->list_indexes(*key).connect(
+		std::bind(&on_list, on_chunk_context, ph::_1),
+		std::bind(&on_finish, final_context, ph::_1));
+}
+
 static void on_backend_status(context_t context, const std::vector<elliptics::backend_status_result_entry> &result,
 		const elliptics::error_info &error)
 {
@@ -17,6 +17,7 @@
 package elliptics
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -66,8 +67,14 @@ For example Remove:
     }
 */
 type Session struct {
-	groups  []uint32
-	session unsafe.Pointer
+	groups   []uint32
+	session  unsafe.Pointer
+	filter   int
+	retry    *RetryPolicy
+	breaker  *CircuitBreaker
+	feedback *PIDFeedback
+	metrics  OperationMetrics
+	tracing  *TracingOptions
 }
 
 //NewSession returns Session connected with given Node.
@@ -79,6 +86,7 @@ func NewSession(node *Node) (*Session, error) {
 	return &Session{
 		session: session,
 		groups:  make([]uint32, 0, 0),
+		filter:  SessionFilterPositive,
 	}, nil
 }
 
@@ -93,8 +101,14 @@ func CloneSession(session *Session) (*Session, error) {
 	copy(groups, session.groups)
 
 	return &Session{
-		session: new_session,
-		groups:  groups,
+		session:  new_session,
+		groups:   groups,
+		filter:   session.filter,
+		retry:    session.retry,
+		breaker:  session.breaker,
+		feedback: session.feedback,
+		metrics:  session.metrics,
+		tracing:  session.tracing,
 	}, nil
 }
 
@@ -149,6 +163,24 @@ func (s *Session) GetTraceID() TraceID {
 	return TraceID(C.session_get_trace_id(s.session))
 }
 
+//SetUserFlags sets user flags which are stored together with written records
+func (s *Session) SetUserFlags(user_flags uint64) {
+	C.session_set_user_flags(s.session, C.uint64_t(user_flags))
+}
+
+func (s *Session) GetUserFlags() uint64 {
+	return uint64(C.session_get_user_flags(s.session))
+}
+
+//SetCacheLifetime sets lifetime of records written into cache, it is rounded up to seconds
+func (s *Session) SetCacheLifetime(lifetime time.Duration) {
+	C.session_set_cache_lifetime(s.session, C.uint64_t((lifetime+time.Second-1)/time.Second))
+}
+
+func (s *Session) GetCacheLifetime() time.Duration {
+	return time.Duration(C.session_get_cache_lifetime(s.session)) * time.Second
+}
+
 func (s *Session) SetTimestamp(ts time.Time) {
 	dtime := C.struct_dnet_time {
 		tsec:	C.uint64_t(ts.Unix()),
@@ -192,8 +224,10 @@ func (s *Session) SetFilter(filter int) {
 	switch filter {
 	case SessionFilterAll:
 		C.session_set_filter_all(s.session)
+		s.filter = filter
 	case SessionFilterPositive:
 		C.session_set_filter_positive(s.session)
+		s.filter = filter
 	}
 }
 
@@ -252,32 +286,47 @@ func (r *readResult) Error() error {
 
 //ReadInto reads data into specified buffer.
 func (s *Session) ReadInto(key *Key, offset uint64, p []byte) <-chan ReadResult {
+	return s.ReadIntoCtx(context.Background(), key, offset, p)
+}
+
+//ReadIntoCtx reads data into specified buffer, read is stopped when @ctx is done.
+//Replies which arrive after the read has been cancelled are dropped before they are copied into @p.
+//A reply which is already being copied when the read is cancelled may still land in @p,
+//so @p should not be reused right away.
+func (s *Session) ReadIntoCtx(ctx context.Context, key *Key, offset uint64, p []byte, options ...CallOption) <-chan ReadResult {
+	opts := callOptions(options)
+
 	responseCh := make(chan ReadResult, defaultVOLUME)
-	onResultContext := NextContext()
-	onFinishContext := NextContext()
-	bufContext := NextContext()
+
+	session, release, err := s.contextSession(ctx, opts)
+	if err != nil {
+		responseCh <- &readResult{err: err}
+		close(responseCh)
+		return responseCh
+	}
+	defer release()
+
+	op := s.newOp(ctx, OpRead, opts)
 
 	onResult := func(result *readResult) {
-		responseCh <- result
+		op.Deliver(func() {
+			op.sendRead(responseCh, result)
+		})
 	}
 
 	onFinish := func(err error) {
 		if err != nil {
-			responseCh <- &readResult{err: err}
+			op.sendRead(responseCh, &readResult{err: err})
 		}
 
 		close(responseCh)
-
-		Pool.Delete(bufContext)
-		Pool.Delete(onResultContext)
-		Pool.Delete(onFinishContext)
 	}
 
-	Pool.Store(bufContext, p)
-	Pool.Store(onResultContext, onResult)
-	Pool.Store(onFinishContext, onFinish)
+	onResultContext := op.Store(onResult)
+	bufContext := op.Retain(p)
+	onFinishContext := op.Finish(onFinish)
 
-	C.session_read_data_into(s.session,
+	C.session_read_data_into(session.session,
 		C.context_t(onResultContext), C.context_t(bufContext), C.context_t(onFinishContext),
 		key.key, C.uint64_t(offset), C.uint64_t(len(p)))
 	return responseCh
@@ -285,44 +334,67 @@ func (s *Session) ReadInto(key *Key, offset uint64, p []byte) <-chan ReadResult
 
 //ReadKey performs a read operation by key.
 func (s *Session) ReadKey(key *Key, offset, size uint64) <-chan ReadResult {
+	return s.ReadKeyCtx(context.Background(), key, offset, size)
+}
+
+//ReadKeyCtx performs a read operation by key, read is stopped when @ctx is done.
+func (s *Session) ReadKeyCtx(ctx context.Context, key *Key, offset, size uint64, options ...CallOption) <-chan ReadResult {
+	opts := callOptions(options)
+
 	responseCh := make(chan ReadResult, defaultVOLUME)
-	onResultContext := NextContext()
-	onFinishContext := NextContext()
+
+	session, release, err := s.contextSession(ctx, opts)
+	if err != nil {
+		responseCh <- &readResult{err: err}
+		close(responseCh)
+		return responseCh
+	}
+	defer release()
+
+	op := s.newOp(ctx, OpRead, opts)
 
 	onResult := func(result *readResult) {
-		responseCh <- result
+		op.Deliver(func() {
+			op.sendRead(responseCh, result)
+		})
 	}
 
 	onFinish := func(err error) {
 		if err != nil {
-			responseCh <- &readResult{err: err}
+			op.sendRead(responseCh, &readResult{err: err})
 		}
 
 		close(responseCh)
-		Pool.Delete(onResultContext)
-		Pool.Delete(onFinishContext)
 	}
 
-	Pool.Store(onResultContext, onResult)
-	Pool.Store(onFinishContext, onFinish)
+	onResultContext := op.Store(onResult)
+	onFinishContext := op.Finish(onFinish)
 
-	C.session_read_data(s.session,
+	C.session_read_data(session.session,
 		C.context_t(onResultContext), C.context_t(onFinishContext),
 		key.key, C.uint64_t(offset), C.uint64_t(size))
 	return responseCh
 }
 
-//ReadKey performs a read operation by string representation of key.
+//ReadData performs a read operation by string representation of key.
 func (s *Session) ReadData(key string, offset, size uint64) <-chan ReadResult {
-	ekey, err := NewKey(key)
-	if err != nil {
-		errCh := make(chan ReadResult, 1)
-		errCh <- &readResult{err: err}
-		close(errCh)
-		return errCh
-	}
-	defer ekey.Free()
-	return s.ReadKey(ekey, offset, size)
+	return s.ReadDataCtx(context.Background(), key, offset, size)
+}
+
+//ReadDataCtx performs a read operation by string representation of key, read is stopped when @ctx is done.
+func (s *Session) ReadDataCtx(ctx context.Context, key string, offset, size uint64, options ...CallOption) <-chan ReadResult {
+	opts := callOptions(options)
+	return s.retryRead(ctx, opts, func() <-chan ReadResult {
+		ekey, err := NewKey(key)
+		if err != nil {
+			errCh := make(chan ReadResult, 1)
+			errCh <- &readResult{err: err}
+			close(errCh)
+			return errCh
+		}
+		defer ekey.Free()
+		return s.ReadKeyCtx(ctx, ekey, offset, size, options...)
+	})
 }
 
 /*
@@ -380,97 +452,75 @@ func (l *lookupResult) Error() error {
 
 //WriteData writes blob by a given string representation of Key.
 func (s *Session) WriteData(key string, input io.Reader, offset, total_size uint64) <-chan Lookuper {
-	if total_size > max_chunk_size {
-		return s.WriteChunk(key, input, offset, total_size)
-	}
-
-	ekey, err := NewKey(key)
-	if err != nil {
-		responseCh := make(chan Lookuper, defaultVOLUME)
-		responseCh <- &lookupResult{err: err}
-		close(responseCh)
-		return responseCh
-	}
-	defer ekey.Free()
-	return s.WriteKey(ekey, input, offset, total_size)
+	return s.WriteDataCtx(context.Background(), key, input, offset, total_size)
 }
 
-func (s *Session) WriteChunk(key string, input io.Reader, initial_offset, total_size uint64) <-chan Lookuper {
-	responseCh := make(chan Lookuper, defaultVOLUME)
-	onChunkContext := NextContext()
-	onFinishContext := NextContext()
-	chunk_context := NextContext()
+//WriteDataCtx writes blob by a given string representation of Key, write is stopped when @ctx is done.
+func (s *Session) WriteDataCtx(ctx context.Context, key string, input io.Reader, offset, total_size uint64, options ...CallOption) <-chan Lookuper {
+	opts := callOptions(options)
 
-	chunk := make([]byte, max_chunk_size, max_chunk_size)
-
-	orig_total_size := total_size
-	offset := initial_offset
-	var n64 uint64
-
-	onChunkResult := func(lookup *lookupResult) {
-		if total_size == 0 {
-			responseCh <- lookup
+	write := func(input io.Reader) <-chan Lookuper {
+		if total_size > max_chunk_size {
+			return s.WriteChunkCtx(ctx, key, input, offset, total_size, options...)
 		}
-	}
-
-	var onChunkFinish func(err error)
 
-	onChunkFinish = func(err error) {
+		ekey, err := NewKey(key)
 		if err != nil {
+			responseCh := make(chan Lookuper, defaultVOLUME)
 			responseCh <- &lookupResult{err: err}
 			close(responseCh)
-			Pool.Delete(onChunkContext)
-			Pool.Delete(onFinishContext)
-			Pool.Delete(chunk_context)
-			return
-		}
-
-		if total_size == 0 {
-			close(responseCh)
-			Pool.Delete(onChunkContext)
-			Pool.Delete(onFinishContext)
-			Pool.Delete(chunk_context)
-			return
+			return responseCh
 		}
+		defer ekey.Free()
+		return s.WriteKeyCtx(ctx, ekey, input, offset, total_size, options...)
+	}
 
-		n, err := input.Read(chunk)
-		if n <= 0 && err != nil {
-			responseCh <- &lookupResult{err: err}
-			close(responseCh)
-			Pool.Delete(onChunkContext)
-			Pool.Delete(onFinishContext)
-			Pool.Delete(chunk_context)
-			return
-		}
+	if s.retryPolicy(opts, true) == nil {
+		return write(input)
+	}
 
-		n64 = uint64(n)
-		total_size -= n64
-		offset += n64
+	rewind := rewindableInput(input, total_size)
+	if rewind == nil {
+		return write(input)
+	}
 
-		ekey, err := NewKey(key)
+	return s.retryLookup(ctx, opts, true, func() <-chan Lookuper {
+		input, err := rewind()
 		if err != nil {
+			responseCh := make(chan Lookuper, 1)
 			responseCh <- &lookupResult{err: err}
 			close(responseCh)
-			Pool.Delete(onChunkContext)
-			Pool.Delete(onFinishContext)
-			Pool.Delete(chunk_context)
-			return
+			return responseCh
 		}
-		defer ekey.Free()
+		return write(input)
+	})
+}
 
-		if total_size != 0 {
-			C.session_write_plain(s.session,
-				C.context_t(onChunkContext), C.context_t(onFinishContext),
-				ekey.key, C.uint64_t(offset-n64),
-				(*C.char)(unsafe.Pointer(&chunk[0])), C.uint64_t(n))
-		} else {
-			C.session_write_commit(s.session,
-				C.context_t(onChunkContext), C.context_t(onFinishContext),
-				ekey.key, C.uint64_t(offset-n64), C.uint64_t(offset),
-				(*C.char)(unsafe.Pointer(&chunk[0])), C.uint64_t(n))
-		}
+func (s *Session) WriteChunk(key string, input io.Reader, initial_offset, total_size uint64) <-chan Lookuper {
+	return s.WriteChunkCtx(context.Background(), key, input, initial_offset, total_size)
+}
+
+//WriteChunkCtx writes blob using prepare/plain/commit sequence of max_chunk_size chunks.
+//If @ctx is done between chunks, no more chunks are sent, if it has a deadline
+//every chunk is sent with a timeout trimmed to the remaining time.
+func (s *Session) WriteChunkCtx(ctx context.Context, key string, input io.Reader, initial_offset, total_size uint64, options ...CallOption) <-chan Lookuper {
+	opts := callOptions(options)
+
+	responseCh := make(chan Lookuper, defaultVOLUME)
+
+	if err := ctx.Err(); err != nil {
+		responseCh <- &lookupResult{err: err}
+		close(responseCh)
+		return responseCh
 	}
 
+	chunk := make([]byte, max_chunk_size, max_chunk_size)
+
+	orig_total_size := total_size
+	offset := initial_offset
+	var n64 uint64
+	start := time.Now()
+
 	rest := total_size
 	if rest > max_chunk_size {
 		rest = max_chunk_size
@@ -506,11 +556,105 @@ func (s *Session) WriteChunk(key string, input io.Reader, initial_offset, total_
 	}
 	defer ekey.Free()
 
-	Pool.Store(onChunkContext, onChunkResult)
-	Pool.Store(onFinishContext, onChunkFinish)
-	Pool.Store(chunk_context, chunk)
+	// all chunks are sent through the same session, so that they go to the groups the record has been prepared in
+	// even if circuit breaker of some group changes its state in the middle of the write
+	session, release, err := s.contextSession(ctx, opts)
+	if err != nil {
+		responseCh <- &lookupResult{err: err}
+		close(responseCh)
+		return responseCh
+	}
+	if _, has_deadline := ctx.Deadline(); has_deadline && session == s {
+		// timeouts of the chunks are trimmed to the deadline, this must not change the shared session
+		clone, err := CloneSession(s)
+		if err != nil {
+			responseCh <- &lookupResult{err: err}
+			close(responseCh)
+			return responseCh
+		}
+		session, release = clone, clone.Delete
+	}
+
+	op := s.newOp(ctx, OpWrite, opts)
+	op.written = orig_total_size
+	op.Defer(release)
+
+	onChunkResult := func(lookup *lookupResult) {
+		if total_size == 0 {
+			if s.feedback != nil {
+				s.feedback.observeWrite(lookup, orig_total_size, start)
+			}
+			op.Deliver(func() {
+				op.sendLookup(responseCh, lookup)
+			})
+		}
+	}
+
+	onFinish := func(err error) {
+		if err != nil {
+			op.sendLookup(responseCh, &lookupResult{err: err})
+		}
+		close(responseCh)
+	}
+
+	var onChunkContext, onFinishContext uint64
+
+	onChunkFinish := func(err error) {
+		if err != nil {
+			op.Stop(err)
+			return
+		}
+
+		if total_size == 0 {
+			op.Stop(nil)
+			return
+		}
+
+		n, err := input.Read(chunk)
+		if n <= 0 && err != nil {
+			op.Stop(err)
+			return
+		}
+
+		n64 = uint64(n)
+		total_size -= n64
+		offset += n64
+
+		ekey, err := NewKey(key)
+		if err != nil {
+			op.Stop(err)
+			return
+		}
+		defer ekey.Free()
+
+		if err := ctx.Err(); err != nil {
+			op.Stop(err)
+			return
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			if timeout, dt := session.GetTimeout(), timeoutFromDeadline(deadline); timeout <= 0 || dt < timeout {
+				session.SetTimeout(dt)
+			}
+		}
+
+		if total_size != 0 {
+			C.session_write_plain(session.session,
+				C.context_t(onChunkContext), C.context_t(onFinishContext),
+				ekey.key, C.uint64_t(offset-n64),
+				(*C.char)(unsafe.Pointer(&chunk[0])), C.uint64_t(n))
+		} else {
+			C.session_write_commit(session.session,
+				C.context_t(onChunkContext), C.context_t(onFinishContext),
+				ekey.key, C.uint64_t(offset-n64), C.uint64_t(offset),
+				(*C.char)(unsafe.Pointer(&chunk[0])), C.uint64_t(n))
+		}
+	}
+
+	onChunkContext = op.Store(onChunkResult)
+	op.Retain(chunk)
+	onFinishContext = op.Chain(onFinish, onChunkFinish)
 
-	C.session_write_prepare(s.session,
+	C.session_write_prepare(session.session,
 		C.context_t(onChunkContext), C.context_t(onFinishContext),
 		ekey.key, C.uint64_t(offset-n64), C.uint64_t(total_size+n64),
 		(*C.char)(unsafe.Pointer(&chunk[0])), C.uint64_t(n))
@@ -519,24 +663,24 @@ func (s *Session) WriteChunk(key string, input io.Reader, initial_offset, total_
 
 //WriteKey writes blob by Key.
 func (s *Session) WriteKey(key *Key, input io.Reader, offset, total_size uint64) <-chan Lookuper {
-	responseCh := make(chan Lookuper, defaultVOLUME)
-	onWriteContext := NextContext()
-	onWriteFinishContext := NextContext()
-	chunk_context := NextContext()
+	return s.WriteKeyCtx(context.Background(), key, input, offset, total_size)
+}
 
-	onWriteResult := func(lookup *lookupResult) {
-		responseCh <- lookup
-	}
+//WriteKeyCtx writes blob by Key, write is stopped when @ctx is done.
+func (s *Session) WriteKeyCtx(ctx context.Context, key *Key, input io.Reader, offset, total_size uint64, options ...CallOption) <-chan Lookuper {
+	return s.writeKeyCtx(ctx, callOptions(options), key, input, false,
+		func(session *Session, onWriteContext, onWriteFinishContext uint64, chunk []byte) {
+			C.session_write_data(session.session,
+				C.context_t(onWriteContext), C.context_t(onWriteFinishContext),
+				key.key, C.uint64_t(offset), (*C.char)(unsafe.Pointer(&chunk[0])), C.uint64_t(len(chunk)))
+		})
+}
 
-	onWriteFinish := func(err error) {
-		if err != nil {
-			responseCh <- &lookupResult{err: err}
-		}
-		close(responseCh)
-		Pool.Delete(onWriteContext)
-		Pool.Delete(onWriteFinishContext)
-		Pool.Delete(chunk_context)
-	}
+// writeKeyCtx reads the whole @input and issues write request @call bound to @ctx,
+// if @cas is set, CAS mismatch replies are reported as CASConflictError.
+func (s *Session) writeKeyCtx(ctx context.Context, opts *CallOptions, key *Key, input io.Reader, cas bool,
+	call func(session *Session, onWriteContext, onWriteFinishContext uint64, chunk []byte)) <-chan Lookuper {
+	responseCh := make(chan Lookuper, defaultVOLUME)
 
 	chunk, err := ioutil.ReadAll(input)
 	if err != nil {
@@ -557,83 +701,126 @@ func (s *Session) WriteKey(key *Key, input io.Reader, offset, total_size uint64)
 		return responseCh
 	}
 
-	Pool.Store(onWriteContext, onWriteResult)
-	Pool.Store(onWriteFinishContext, onWriteFinish)
-	Pool.Store(chunk_context, chunk)
-
-	C.session_write_data(s.session,
-		C.context_t(onWriteContext), C.context_t(onWriteFinishContext),
-		key.key, C.uint64_t(offset), (*C.char)(unsafe.Pointer(&chunk[0])), C.uint64_t(len(chunk)))
+	session, release, err := s.contextSession(ctx, opts)
+	if err != nil {
+		responseCh <- &lookupResult{err: err}
+		close(responseCh)
+		return responseCh
+	}
+	defer release()
 
-	return responseCh
-}
+	op := s.newOp(ctx, OpWrite, opts)
+	op.written = uint64(len(chunk))
+	start := time.Now()
 
-// Lookup returns an information about given Key.
-// It only returns the first group where key has been found.
-func (s *Session) Lookup(key *Key) <-chan Lookuper {
-	responseCh := make(chan Lookuper, defaultVOLUME)
-	onResultContext := NextContext()
-	onFinishContext := NextContext()
+	onWriteResult := func(lookup *lookupResult) {
+		if cas {
+			lookup.err = casConflict(lookup.cmd.ID.Group, lookup.err)
+		}
+		if s.feedback != nil {
+			s.feedback.observeWrite(lookup, uint64(len(chunk)), start)
+		}
 
-	onResult := func(lookup *lookupResult) {
-		responseCh <- lookup
+		op.Deliver(func() {
+			op.sendLookup(responseCh, lookup)
+		})
 	}
 
-	onFinish := func(err error) {
+	onWriteFinish := func(err error) {
 		if err != nil {
-			responseCh <- &lookupResult{err: err}
+			op.sendLookup(responseCh, &lookupResult{err: err})
 		}
 		close(responseCh)
-		Pool.Delete(onResultContext)
-		Pool.Delete(onFinishContext)
 	}
 
-	Pool.Store(onResultContext, onResult)
-	Pool.Store(onFinishContext, onFinish)
+	onWriteContext := op.Store(onWriteResult)
+	op.Retain(chunk)
+	onWriteFinishContext := op.Finish(onWriteFinish)
 
-	C.session_lookup(s.session, C.context_t(onResultContext), C.context_t(onFinishContext), key.key)
+	call(session, onWriteContext, onWriteFinishContext, chunk)
 	return responseCh
 }
 
-// ParallelLookupKey returns all information about given Key,
-// it sends multiple lookup requests in parallel to all session groups
-// and returns information about all specified group where given key has been found.
-func (s *Session) ParallelLookupKey(key *Key) <-chan Lookuper {
+// lookupCtx issues lookup-like request @call bound to @ctx and returns channel of its results.
+func (s *Session) lookupCtx(ctx context.Context, opts *CallOptions,
+	call func(session *Session, onResultContext, onFinishContext uint64)) <-chan Lookuper {
 	responseCh := make(chan Lookuper, defaultVOLUME)
-	onResultContext := NextContext()
-	onFinishContext := NextContext()
+
+	session, release, err := s.contextSession(ctx, opts)
+	if err != nil {
+		responseCh <- &lookupResult{err: err}
+		close(responseCh)
+		return responseCh
+	}
+	defer release()
+
+	op := s.newOp(ctx, OpLookup, opts)
 
 	onResult := func(lookup *lookupResult) {
-		responseCh <- lookup
+		op.Deliver(func() {
+			op.sendLookup(responseCh, lookup)
+		})
 	}
 
 	onFinish := func(err error) {
 		if err != nil {
-			responseCh <- &lookupResult{err: err}
+			op.sendLookup(responseCh, &lookupResult{err: err})
 		}
 		close(responseCh)
-		Pool.Delete(onResultContext)
-		Pool.Delete(onFinishContext)
 	}
 
-	Pool.Store(onResultContext, onResult)
-	Pool.Store(onFinishContext, onFinish)
-	/* To keep callbacks alive */
-	C.session_parallel_lookup(s.session, C.context_t(onResultContext), C.context_t(onFinishContext), key.key)
+	onResultContext := op.Store(onResult)
+	onFinishContext := op.Finish(onFinish)
+
+	call(session, onResultContext, onFinishContext)
 	return responseCh
 }
 
+// Lookup returns an information about given Key.
+// It only returns the first group where key has been found.
+func (s *Session) Lookup(key *Key) <-chan Lookuper {
+	return s.LookupCtx(context.Background(), key)
+}
+
+// LookupCtx is a Lookup which is stopped when @ctx is done.
+func (s *Session) LookupCtx(ctx context.Context, key *Key, options ...CallOption) <-chan Lookuper {
+	return s.lookupCtx(ctx, callOptions(options), func(session *Session, onResultContext, onFinishContext uint64) {
+		C.session_lookup(session.session, C.context_t(onResultContext), C.context_t(onFinishContext), key.key)
+	})
+}
+
+// ParallelLookupKey returns all information about given Key,
+// it sends multiple lookup requests in parallel to all session groups
+// and returns information about all specified group where given key has been found.
+func (s *Session) ParallelLookupKey(key *Key) <-chan Lookuper {
+	return s.ParallelLookupKeyCtx(context.Background(), key)
+}
+
+// ParallelLookupKeyCtx is a ParallelLookupKey which is stopped when @ctx is done.
+func (s *Session) ParallelLookupKeyCtx(ctx context.Context, key *Key, options ...CallOption) <-chan Lookuper {
+	return s.lookupCtx(ctx, callOptions(options), func(session *Session, onResultContext, onFinishContext uint64) {
+		C.session_parallel_lookup(session.session, C.context_t(onResultContext), C.context_t(onFinishContext), key.key)
+	})
+}
+
 func (s *Session) ParallelLookup(kstr string) <-chan Lookuper {
-	key, err := NewKey(kstr)
-	if err != nil {
-		responseCh := make(chan Lookuper, defaultVOLUME)
-		responseCh <- &lookupResult{err: err}
-		close(responseCh)
-		return responseCh
-	}
-	defer key.Free()
+	return s.ParallelLookupCtx(context.Background(), kstr)
+}
 
-	return s.ParallelLookupKey(key)
+func (s *Session) ParallelLookupCtx(ctx context.Context, kstr string, options ...CallOption) <-chan Lookuper {
+	opts := callOptions(options)
+	return s.retryLookup(ctx, opts, false, func() <-chan Lookuper {
+		key, err := NewKey(kstr)
+		if err != nil {
+			responseCh := make(chan Lookuper, defaultVOLUME)
+			responseCh <- &lookupResult{err: err}
+			close(responseCh)
+			return responseCh
+		}
+		defer key.Free()
+
+		return s.ParallelLookupKeyCtx(ctx, key, options...)
+	})
 }
 
 func (s *Session) ParallelLookupID(id *DnetRawID) <-chan Lookuper {
@@ -685,44 +872,74 @@ func (r *removeResult) Error() error {
 
 //Remove performs remove operation by a string.
 func (s *Session) Remove(key string) <-chan Remover {
-	ekey, err := NewKey(key)
+	return s.RemoveCtx(context.Background(), key)
+}
+
+//RemoveCtx performs remove operation by a string, it is stopped when @ctx is done.
+func (s *Session) RemoveCtx(ctx context.Context, key string, options ...CallOption) <-chan Remover {
+	opts := callOptions(options)
+	return s.retryRemove(ctx, opts, func() <-chan Remover {
+		ekey, err := NewKey(key)
+		if err != nil {
+			responseCh := make(chan Remover, defaultVOLUME)
+			responseCh <- &removeResult{err: err}
+			close(responseCh)
+			return responseCh
+		}
+		defer ekey.Free()
+		return s.RemoveKeyCtx(ctx, ekey, options...)
+	})
+}
+
+//RemoveKey performs remove operation by key.
+func (s *Session) RemoveKey(key *Key) <-chan Remover {
+	return s.RemoveKeyCtx(context.Background(), key)
+}
+
+//RemoveKeyCtx performs remove operation by key, it is stopped when @ctx is done.
+func (s *Session) RemoveKeyCtx(ctx context.Context, key *Key, options ...CallOption) <-chan Remover {
+	opts := callOptions(options)
+
+	responseCh := make(chan Remover, defaultVOLUME)
+
+	session, release, err := s.contextSession(ctx, opts)
 	if err != nil {
-		responseCh := make(chan Remover, defaultVOLUME)
 		responseCh <- &removeResult{err: err}
 		close(responseCh)
 		return responseCh
 	}
-	defer ekey.Free()
-	return s.RemoveKey(ekey)
-}
+	defer release()
 
-//RemoveKey performs remove operation by key.
-func (s *Session) RemoveKey(key *Key) <-chan Remover {
-	responseCh := make(chan Remover, defaultVOLUME)
-	onResultContext := NextContext()
-	onFinishContext := NextContext()
+	op := s.newOp(ctx, OpRemove, opts)
 
 	onResult := func(r *removeResult) {
-		responseCh <- r
+		op.Deliver(func() {
+			op.sendRemove(responseCh, r)
+		})
 	}
 	onFinish := func(err error) {
 		if err != nil {
-			responseCh <- &removeResult{err: err}
+			op.sendRemove(responseCh, &removeResult{err: err})
 		}
 		close(responseCh)
-
-		Pool.Delete(onResultContext)
-		Pool.Delete(onFinishContext)
 	}
 
-	Pool.Store(onResultContext, onResult)
-	Pool.Store(onFinishContext, onFinish)
-	C.session_remove(s.session, C.context_t(onResultContext), C.context_t(onFinishContext), key.key)
+	onResultContext := op.Store(onResult)
+	onFinishContext := op.Finish(onFinish)
+	C.session_remove(session.session, C.context_t(onResultContext), C.context_t(onFinishContext), key.key)
 	return responseCh
 }
 
 //BulkRemove removes keys from array. It returns error for every key it could not delete.
 func (s *Session) BulkRemove(keys_str []string) <-chan Remover {
+	return s.BulkRemoveCtx(context.Background(), keys_str)
+}
+
+//BulkRemoveCtx removes keys from array, it is stopped when @ctx is done.
+//It returns error for every key it could not delete.
+func (s *Session) BulkRemoveCtx(ctx context.Context, keys_str []string, options ...CallOption) <-chan Remover {
+	opts := callOptions(options)
+
 	responseCh := make(chan Remover, defaultVOLUME)
 
 	keys, err := NewKeys(keys_str)
@@ -734,50 +951,180 @@ func (s *Session) BulkRemove(keys_str []string) <-chan Remover {
 		close(responseCh)
 		return responseCh
 	}
-	defer keys.Free()
 
-	onResultContext := NextContext()
-	onFinishContext := NextContext()
+	session, release, err := s.contextSession(ctx, opts)
+	if err != nil {
+		keys.Free()
+		responseCh <- &removeResult{
+			key: "overall operation result",
+			err: err,
+		}
+		close(responseCh)
+		return responseCh
+	}
+	defer release()
+
+	op := s.newOp(ctx, OpBulkRemove, opts)
+	// bulk remove always requests negative replies, see session_bulk_remove()
+	op.positive = false
+	// result callbacks look keys up, they can only be freed after the final reply
+	op.Defer(keys.Free)
 
 	onResult := func(r *removeResult) {
 		if r.err != nil {
-			responseCh <- r
+			op.Deliver(func() {
+				op.sendRemove(responseCh, r)
+			})
 		} else if r.cmd.Status != 0 {
 
 			key, err := keys.Find(r.Cmd().ID.ID)
 			if err != nil {
-				responseCh <- &removeResult{
-					key: "could not find key for replied ID",
-					err: err,
-				}
+				op.Deliver(func() {
+					op.sendRemove(responseCh, &removeResult{
+						key: "could not find key for replied ID",
+						err: err,
+					})
+				})
 				return
 			}
 
 			r.err = fmt.Errorf("remove status: %d", r.cmd.Status)
 			r.key = key
-			responseCh <- r
+			op.Deliver(func() {
+				op.sendRemove(responseCh, r)
+			})
 		}
 	}
 	onFinish := func(err error) {
 		if err != nil {
-			responseCh <- &removeResult{
+			op.sendRemove(responseCh, &removeResult{
 				key: "overall operation result",
 				err: err,
-			}
+			})
 		}
 
 		close(responseCh)
-		Pool.Delete(onResultContext)
-		Pool.Delete(onFinishContext)
 	}
 
-	Pool.Store(onResultContext, onResult)
-	Pool.Store(onFinishContext, onFinish)
-	C.session_bulk_remove(s.session, C.context_t(onResultContext), C.context_t(onFinishContext), keys.keys)
+	onResultContext := op.Store(onResult)
+	onFinishContext := op.Finish(onFinish)
+	C.session_bulk_remove(session.session, C.context_t(onResultContext), C.context_t(onFinishContext), keys.keys)
 
 	return responseCh
 }
 
+type bulkReadResult struct {
+	key    string
+	result *readResult
+}
+
+//BulkRead reads all keys from array at once.
+//It returns result for every key, keys which have not been found in any group get -ENOENT error.
+//If the operation has failed after some replies have been received, keys without reply get its error instead.
+//Error is returned only if the whole operation has failed.
+func (s *Session) BulkRead(keys_str []string) (map[string]ReadResult, error) {
+	return s.BulkReadCtx(context.Background(), keys_str)
+}
+
+//BulkReadCtx is a BulkRead which is stopped when @ctx is done, in that case
+//results received so far are returned together with the context error.
+func (s *Session) BulkReadCtx(ctx context.Context, keys_str []string, options ...CallOption) (map[string]ReadResult, error) {
+	opts := callOptions(options)
+
+	keys, err := NewKeys(keys_str)
+	if err != nil {
+		return nil, err
+	}
+
+	session, release, err := s.contextSession(ctx, opts)
+	if err != nil {
+		keys.Free()
+		return nil, err
+	}
+	defer release()
+
+	responseCh := make(chan interface{}, defaultVOLUME)
+	op := s.newOp(ctx, OpBulkRead, opts)
+	// bulk read always requests negative replies, see session_bulk_read()
+	op.positive = false
+	// result callbacks look keys up, they can only be freed after the final reply
+	op.Defer(keys.Free)
+
+	onResult := func(r *readResult) {
+		key, err := keys.Find(r.cmd.ID.ID)
+		if err != nil {
+			// reply for a key we have not asked for
+			return
+		}
+
+		op.Deliver(func() {
+			ev := newOperationEvent(&r.cmd, &r.addr, r.err)
+			ev.BytesRead = uint64(len(r.data))
+			op.observe(ev)
+
+			op.sendAny(responseCh, &bulkReadResult{
+				key:    key,
+				result: r,
+			})
+		})
+	}
+
+	onFinish := func(err error) {
+		if err != nil {
+			op.sendAny(responseCh, err)
+		}
+		close(responseCh)
+	}
+
+	onResultContext := op.Store(onResult)
+	onFinishContext := op.Finish(onFinish)
+	C.session_bulk_read(session.session, C.context_t(onResultContext), C.context_t(onFinishContext), keys.keys)
+
+	results := make(map[string]ReadResult, len(keys_str))
+	for r := range responseCh {
+		switch r := r.(type) {
+		case error:
+			err = r
+		case *bulkReadResult:
+			// successful reply from any group wins over errors from others
+			if prev, ok := results[r.key]; !ok || prev.Error() != nil {
+				results[r.key] = r.result
+			}
+		}
+	}
+
+	if err != nil && len(results) == 0 {
+		return nil, err
+	}
+
+	// results gathered so far are returned when the operation has been stopped by @ctx
+	if err := ctx.Err(); err != nil {
+		return results, err
+	}
+
+	for _, key := range keys_str {
+		if _, ok := results[key]; ok {
+			continue
+		}
+
+		// key is known to be missing only if the operation has completed cleanly
+		if err != nil {
+			results[key] = &readResult{err: err}
+			continue
+		}
+
+		results[key] = &readResult{
+			err: &DnetError{
+				Code:    -2, // -ENOENT
+				Flags:   0,
+				Message: fmt.Sprintf("key %s has not been found", key),
+			},
+		}
+	}
+
+	return results, nil
+}
+
 func (s *Session) LookupBackend(key string, group_id uint32) (addr *DnetAddr, backend_id int32, err error) {
 	var caddr *C.struct_dnet_addr = C.dnet_addr_alloc()
 	defer C.dnet_addr_free(caddr)
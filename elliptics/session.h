@@ -69,6 +69,26 @@ struct go_error {
 };
 
 
+//index_entry
+struct go_index_entry {
+	const struct dnet_raw_id	*index;
+	const char			*data;
+	uint64_t			size;
+};
+
+//find_indexes_result_entry
+struct go_find_result {
+	const struct dnet_raw_id	*id;
+	const struct go_index_entry	*entries;
+	uint64_t			entries_count;
+};
+
+//callback_result_entry of set/update/remove indexes operations
+struct go_index_result {
+	const struct dnet_cmd		*cmd;
+	const struct dnet_addr		*addr;
+};
+
 struct go_iterator_range {
 	uint8_t	*key_begin;
 	uint8_t *key_end;
@@ -115,6 +135,12 @@ ioflags_t session_get_ioflags(ell_session *session);
 void session_set_trace_id(ell_session *session, trace_id_t trace_id);
 trace_id_t session_get_trace_id(ell_session *session);
 
+void session_set_user_flags(ell_session *session, uint64_t user_flags);
+uint64_t session_get_user_flags(ell_session *session);
+// lifetime of records written into cache, in seconds
+void session_set_cache_lifetime(ell_session *session, uint64_t lifetime);
+uint64_t session_get_cache_lifetime(ell_session *session);
+
 void session_set_timestamp(ell_session *session, const struct dnet_time *ts);
 void session_get_timestamp(ell_session *session, struct dnet_time *ts);
 
@@ -131,6 +157,10 @@ void session_read_data(ell_session *session, context_t on_chunk_context,
 		context_t final_context, ell_key *key, uint64_t offset, uint64_t size);
 void session_write_data(ell_session *session, context_t on_chunk_context,
 		context_t final_context, ell_key *key, uint64_t offset, char *data, uint64_t size);
+// compare-and-swap write, the data is written only if checksum of the stored record matches @csum (DNET_ID_SIZE bytes)
+void session_write_cas(ell_session *session, context_t on_chunk_context,
+		context_t final_context, ell_key *key, const uint8_t *csum,
+		uint64_t offset, char *data, uint64_t size);
 
 // prepare/write/commit sequence for large objects
 // @offset says on which offset should data go
@@ -155,6 +185,25 @@ void session_write_commit(ell_session *session, context_t on_chunk_context,
 void session_remove(ell_session *session, context_t on_chunk_context,
 		context_t final_context, ell_key *key);
 void session_bulk_remove(ell_session *session, context_t on_chunk_context, context_t final_context, void *ekeys);
+// reads all records from @ekeys at once, replies are sent for every found and every failed key
+void session_bulk_read(ell_session *session, context_t on_chunk_context, context_t final_context, void *ekeys);
+
+// secondary indexes
+// @indexes is an array of @count index names, @data contains data to be attached to the key in every index
+void session_set_indexes(ell_session *session, context_t on_chunk_context, context_t final_context,
+		ell_key *key, const char **indexes, const struct go_data_pointer *data, uint64_t count);
+void session_update_indexes(ell_session *session, context_t on_chunk_context, context_t final_context,
+		ell_key *key, const char **indexes, const struct go_data_pointer *data, uint64_t count);
+void session_remove_indexes(ell_session *session, context_t on_chunk_context, context_t final_context,
+		ell_key *key, const char **indexes, uint64_t count);
+// ->find_all_indexes() returns keys which are present in all given indexes,
+// ->find_any_indexes() returns keys which are present in at least one of them
+void session_find_all_indexes(ell_session *session, context_t on_chunk_context, context_t final_context,
+		const char **indexes, uint64_t count);
+void session_find_any_indexes(ell_session *session, context_t on_chunk_context, context_t final_context,
+		const char **indexes, uint64_t count);
+void session_list_indexes(ell_session *session, context_t on_chunk_context, context_t final_context,
+		ell_key *key);
 
 struct go_backends_status {
 	struct dnet_backend_status_list		*list;
@@ -17,6 +17,7 @@ package elliptics
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -52,6 +53,10 @@ const (
 	DefragStateInProgress int32 = 1
 )
 
+// DefaultStatCategories are requested by DnetStat, cache statistics are only requested explicitly
+// with DnetStatCategoriesCtx.
+const DefaultStatCategories = StatCategoryBackend | StatCategoryProcFS | StatCategoryCommands
+
 var (
 	BackendStateString = map[int32]string{
 		BackendStateDisabled:     "disabled",
@@ -99,6 +104,20 @@ type VFS struct {
 	RecordsCorrupted uint64
 }
 
+// CacheStat is only filled when StatCategoryCache has been requested.
+type CacheStat struct {
+	// maximum size of the cache in bytes
+	SizeLimit uint64
+
+	// size and number of records in cache
+	Size    uint64
+	Objects uint64
+
+	// size and number of records scheduled for removal from cache
+	RemovingSize    uint64
+	RemovingObjects uint64
+}
+
 type CStat struct {
 	RequestsSuccess  uint64
 	RequestsFailures uint64
@@ -215,6 +234,9 @@ type StatBackend struct {
 	// VFS statistics: available, used and total space
 	VFS VFS
 
+	// cache statistics
+	Cache CacheStat
+
 	// PID-controller used for data writing
 	PID *PID
 
@@ -242,7 +264,11 @@ func (backend *StatBackend) PIDPain() float64 {
 	return backend.PID.Pain
 }
 func (backend *StatBackend) PIDUpdate(e float64) {
-	p := backend.PID
+	backend.PID.Update(e)
+}
+
+// Update feeds error @e (desired minus measured performance) into the controller and recomputes pain.
+func (p *PID) Update(e float64) {
 	p.Lock()
 	defer p.Unlock()
 
@@ -443,6 +469,9 @@ func (entry *StatEntry) Group() uint32 {
 //export go_stat_callback
 func go_stat_callback(result *C.struct_go_stat_result, key uint64) {
 	context, err := Pool.Get(key)
+	if err == ContextCancelledError {
+		return
+	}
 	if err != nil {
 		panic("Unable to find session numbder")
 	}
@@ -464,48 +493,68 @@ func go_stat_callback(result *C.struct_go_stat_result, key uint64) {
 }
 
 func (s *Session) DnetStat() *DnetStat {
-	response := NewDChannel()
+	st, _ := s.DnetStatCtx(context.Background())
+	return st
+}
+
+// DnetStatCtx collects statistics like DnetStat, but stops waiting for replies when @ctx is done.
+// In that case statistics gathered so far is returned together with the context error.
+func (s *Session) DnetStatCtx(ctx context.Context, options ...CallOption) (*DnetStat, error) {
+	return s.DnetStatCategoriesCtx(ctx, DefaultStatCategories, options...)
+}
+
+// DnetStatCategoriesCtx is a DnetStatCtx which requests given @categories (StatCategory* bit mask),
+// for example DefaultStatCategories|StatCategoryCache to get cache statistics too.
+func (s *Session) DnetStatCategoriesCtx(ctx context.Context, categories int64, options ...CallOption) (*DnetStat, error) {
+	st := &DnetStat{
+		Group: make(map[uint32]*StatGroup),
+	}
 
-	onResultContext := NextContext()
-	onFinishContext := NextContext()
+	session, release, err := s.contextSession(ctx, callOptions(options))
+	if err != nil {
+		return st, err
+	}
+	defer release()
+	s.keepFilter(session)
+
+	// operation closes the input channel when @ctx is done, values already received are still drained below
+	response := NewDChannel()
+	op := newAsyncOp(ctx)
 
 	onResult := func(result *StatEntry) {
-		response.In <- result
+		op.Deliver(func() {
+			op.sendAny(response.In, result)
+		})
 	}
 
 	onFinish := func(err error) {
 		if err != nil {
-			response.In <- &StatEntry{
+			op.sendAny(response.In, &StatEntry{
 				err: err,
-			}
+			})
 		}
 
 		close(response.In)
-		Pool.Delete(onResultContext)
-		Pool.Delete(onFinishContext)
 	}
 
-	Pool.Store(onResultContext, onResult)
-	Pool.Store(onFinishContext, onFinish)
-
-	categories := StatCategoryBackend | StatCategoryProcFS | StatCategoryCommands
+	onResultContext := op.Store(onResult)
+	onFinishContext := op.Finish(onFinish)
 
-	C.session_get_stats(s.session,
+	C.session_get_stats(session.session,
 		C.context_t(onResultContext), C.context_t(onFinishContext),
 		C.uint64_t(categories))
 
-	st := &DnetStat{
-		Group: make(map[uint32]*StatGroup),
-	}
-
 	s.GetRoutes(st)
 
 	// read stat results from the channel and update DnetStat
 	for se := range response.Out {
-		st.AddStatEntry(se.(*StatEntry))
+		// overall operation error carries no statistics
+		if entry := se.(*StatEntry); entry.err == nil {
+			st.AddStatEntry(entry)
+		}
 	}
 
-	return st
+	return st, ctx.Err()
 }
 
 // @Diff() updates differential counters like success/failure RPS and BPS
@@ -569,10 +618,20 @@ func (stat *DnetStat) FindCreateBackend(group uint32, addr *DnetAddr, backend_id
 	return backend
 }
 
+// statBackendAttrs returns log attributes of the backend @vnode reported in @entry
+func statBackendAttrs(entry *StatEntry, vnode *VNode) map[string]string {
+	return map[string]string{
+		"addr":    entry.addr.String(),
+		"backend": fmt.Sprintf("%d", vnode.BackendID),
+		"group":   fmt.Sprintf("%d", vnode.Backend.Config.Group),
+	}
+}
+
 func (stat *DnetStat) AddStatEntry(entry *StatEntry) {
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Printf("Shitty json: %v\n", r)
+			logf(LogError, map[string]string{"addr": entry.addr.String()},
+				"stat: could not process stat entry reply: %v", r)
 		}
 	}()
 
@@ -580,21 +639,22 @@ func (stat *DnetStat) AddStatEntry(entry *StatEntry) {
 
 	err := json.Unmarshal(entry.stat, &r)
 	if err != nil {
-		log.Printf("%s: could not parse stat entry '%s' reply: %v\n", entry.addr.String(), string(entry.stat), err)
+		logf(LogError, map[string]string{"addr": entry.addr.String()},
+			"stat: could not parse stat entry '%s' reply: %v", string(entry.stat), err)
 	}
 
 	stat.Time = time.Unix(int64(r.Timestamp.Sec), int64(r.Timestamp.USec*1000))
 
 	if r.MonitorStatus != "enabled" {
-		log.Printf("%s: monitoring doesn't work: %v\n", entry.addr.String(), r.MonitorStatus)
+		logf(LogWarning, map[string]string{"addr": entry.addr.String()},
+			"stat: monitoring doesn't work: %v", r.MonitorStatus)
 		return
 	}
 
 	good_backends := 0
 	for _, vnode := range r.Backends {
 		if vnode.Status.State != BackendStateEnabled {
-			log.Printf("stat: addr: %s, backend: %d, group: %d: DISABLED\n",
-				entry.addr.String(), int32(vnode.BackendID), vnode.Backend.Config.Group)
+			logf(LogInfo, statBackendAttrs(entry, &vnode), "stat: backend is DISABLED")
 			// do not update backend statistics
 			continue
 		}
@@ -602,8 +662,7 @@ func (stat *DnetStat) AddStatEntry(entry *StatEntry) {
 		backend := stat.FindCreateBackend(vnode.Backend.Config.Group, &entry.addr, int32(vnode.BackendID))
 
 		if vnode.Backend.Error.Code != 0 {
-			log.Printf("stat: addr: %s, backend: %d, group: %d: ERROR: %d\n",
-				entry.addr.String(), int32(vnode.BackendID), vnode.Backend.Config.Group, vnode.Backend.Error.Code)
+			logf(LogError, statBackendAttrs(entry, &vnode), "stat: backend ERROR: %d", vnode.Backend.Error.Code)
 			backend.Error = vnode.Backend.Error
 		}
 
@@ -625,6 +684,14 @@ func (stat *DnetStat) AddStatEntry(entry *StatEntry) {
 		//	entry.addr.String(), int32(vnode.BackendID), vnode.Backend.Config.Group,
 		//	backend.VFS.BackendUsedSize, backend.VFS.TotalSizeLimit)
 
+		backend.Cache = CacheStat{
+			SizeLimit:       vnode.Cache.Size,
+			Size:            vnode.Cache.TotalCaches.Size,
+			Objects:         vnode.Cache.TotalCaches.ObjectsNum,
+			RemovingSize:    vnode.Cache.TotalCaches.RemovingSize,
+			RemovingObjects: vnode.Cache.TotalCaches.RemovingObjectsNum,
+		}
+
 		backend.DefragStartTime = time.Unix(int64(vnode.Backend.GlobalStats.DataSortStartTime), 0)
 		backend.DefragCompletionTime = time.Unix(int64(vnode.Backend.GlobalStats.DataSortCompletionTime), 0)
 		backend.DefragCompletionStatus = vnode.Backend.GlobalStats.DataSortCompletionStatus
@@ -644,8 +711,8 @@ func (stat *DnetStat) AddStatEntry(entry *StatEntry) {
 		good_backends++
 	}
 
-	log.Printf("stat: addr: %s, good-backends: %d/%d\n",
-		entry.addr.String(), good_backends, len(r.Backends))
+	logf(LogInfo, map[string]string{"addr": entry.addr.String()}, "stat: good-backends: %d/%d",
+		good_backends, len(r.Backends))
 
 	return
 }
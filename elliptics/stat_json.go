@@ -15,7 +15,9 @@
 
 package elliptics
 
-import ()
+import (
+	"encoding/json"
+)
 
 type Time struct {
 	Sec  uint64 `json:"tv_sec"`
@@ -146,10 +148,53 @@ func (c *Command) Bytes() uint64 {
 	return c.Cache.Bytes() + c.Disk.Bytes()
 }
 
+type CacheStatRaw struct {
+	Size               uint64 `json:"size"`
+	RemovingSize       uint64 `json:"removing_size"`
+	ObjectsNum         uint64 `json:"objects_num"`
+	RemovingObjectsNum uint64 `json:"removing_objects_num"`
+}
+type CacheRaw struct {
+	// maximum size of the cache
+	Size        uint64                  `json:"size"`
+	TotalCaches CacheStatRaw            `json:"total_caches"`
+	Caches      map[string]CacheStatRaw `json:"caches"`
+}
+
+// UnmarshalJSON never fails: fields of unexpected format are left zero,
+// so that cache statistics can not break parsing of other statistics of the backend.
+func (c *CacheRaw) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		logf(LogDebug, nil, "stat: could not parse cache statistics: %v", err)
+		return nil
+	}
+
+	values := map[string]interface{}{
+		"size":         &c.Size,
+		"total_caches": &c.TotalCaches,
+		"caches":       &c.Caches,
+	}
+	for name, value := range values {
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+
+		if err := json.Unmarshal(raw, value); err != nil {
+			logf(LogDebug, map[string]string{"field": name},
+				"stat: could not parse cache statistics: %v", err)
+		}
+	}
+
+	return nil
+}
+
 type VNode struct {
 	BackendID int                `json:"backend_id"`
 	Status    Status             `json:"status"`
 	Backend   Backend            `json:"backend"`
+	Cache     CacheRaw           `json:"cache"`
 	Commands  map[string]Command `json:"commands"`
 }
 
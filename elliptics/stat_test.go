@@ -0,0 +1,91 @@
+package elliptics
+
+import (
+	"fmt"
+
+	. "gopkg.in/check.v1"
+)
+
+func init() {
+	Suite(&StatSuite{})
+}
+
+type StatSuite struct{}
+
+// statFixture is a monitor reply with one enabled backend of group 2, @cache is its cache section
+const statFixture = `{
+	"timestamp": {"tv_sec": 1500000000, "tv_usec": 500000},
+	"monitor_status": "enabled",
+	"backends": {
+		"1": {
+			"backend_id": 1,
+			"status": {"state": 1, "defrag_state": 0, "read_only": false, "delay": 0},
+			"backend": {
+				"config": {"group": 2, "data": "/srv/elliptics/1/data", "blob_size_limit": 0, "blob_flags": 0},
+				"summary_stats": {"records_total": 10, "records_removed": 1, "base_size": 4096},
+				"vfs": {"bsize": 4096, "frsize": 4096, "blocks": 1000, "bfree": 500, "bavail": 500},
+				"error": {"code": 0}
+			},
+			"cache": %s,
+			"commands": {
+				"READ": {
+					"cache": {"outside": {"successes": 1, "failures": 0, "size": 10, "time": 1}},
+					"disk": {"outside": {"successes": 2, "failures": 1, "size": 20, "time": 2}}
+				}
+			}
+		}
+	}
+}`
+
+func (s *StatSuite) parse(c *C, cache string) *StatBackend {
+	stat := &DnetStat{
+		Group: make(map[uint32]*StatGroup),
+	}
+	stat.AddStatEntry(&StatEntry{
+		addr: DnetAddr{Addr: []byte{127, 0, 0, 1, 0, 0, 0, 0}, Family: 2},
+		stat: []byte(fmt.Sprintf(statFixture, cache)),
+	})
+
+	c.Assert(stat.Group, HasLen, 1)
+	c.Assert(stat.Group[2], NotNil)
+	c.Assert(stat.Group[2].Ab, HasLen, 1)
+
+	for _, sb := range stat.Group[2].Ab {
+		c.Check(sb.VFS.Total, Equals, uint64(4096*1000))
+		c.Check(sb.VFS.RecordsTotal, Equals, uint64(10))
+		c.Check(sb.Commands["READ"].RequestsSuccess, Equals, uint64(3))
+		return sb
+	}
+
+	return nil
+}
+
+func (s *StatSuite) TestCacheStat(c *C) {
+	sb := s.parse(c, `{
+		"size": 1048576,
+		"total_caches": {"size": 300, "removing_size": 100, "objects_num": 3, "removing_objects_num": 1},
+		"caches": {
+			"0": {"size": 200, "removing_size": 100, "objects_num": 2, "removing_objects_num": 1},
+			"1": {"size": 100, "removing_size": 0, "objects_num": 1, "removing_objects_num": 0}
+		}
+	}`)
+	c.Assert(sb.Cache, DeepEquals, CacheStat{
+		SizeLimit:       1048576,
+		Size:            300,
+		Objects:         3,
+		RemovingSize:    100,
+		RemovingObjects: 1,
+	})
+
+	// cache section of unexpected shape does not break other statistics
+	sb = s.parse(c, `{
+		"size": 1048576,
+		"total_caches": {"size": 300, "objects_num": 3},
+		"caches": [{"size": 300, "objects_num": 3}]
+	}`)
+	c.Assert(sb.Cache.SizeLimit, Equals, uint64(1048576))
+	c.Assert(sb.Cache.Objects, Equals, uint64(3))
+
+	sb = s.parse(c, `"disabled"`)
+	c.Assert(sb.Cache, DeepEquals, CacheStat{})
+}
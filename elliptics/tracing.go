@@ -0,0 +1,135 @@
+/*
+ * 2016+ Copyright (c) Evgeniy Polyakov <zbr@ioremap.net>
+ * All rights reserved.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ */
+
+package elliptics
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"math"
+)
+
+// Span receives replies of one traced session operation.
+type Span interface {
+	// Reply is called for every server reply, event carries group, address, backend and status (see OperationEvent.Code).
+	// It is called from elliptics IO threads and must not block.
+	Reply(ev OperationEvent)
+
+	// End is called once when operation completes, @err is the error of the whole operation,
+	// replies of the failed groups are reported via Reply.
+	End(err error)
+}
+
+// Tracer opens spans for session operations, it can be backed by OpenTelemetry or any other tracing system.
+type Tracer interface {
+	// StartSpan is called when operation @op (see Op* constants) is started with trace id @trace,
+	// which is zero if neither context nor session carry it.
+	StartSpan(ctx context.Context, op string, trace TraceID) Span
+}
+
+// TracingOptions configure tracing of session operations.
+type TracingOptions struct {
+	// Tracer (if not nil) opens span for every operation
+	Tracer Tracer
+
+	// SampleRate is the part of trace ids whose requests are sent with DNET_FLAGS_TRACE_BIT,
+	// which makes server log them verbosely: 0 - none, 1 - all.
+	// Sampling decision depends on trace id only, thus all requests of one trace are sampled or none of them.
+	SampleRate float64
+}
+
+func (t *TracingOptions) sampled(trace TraceID) bool {
+	switch {
+	case trace == 0 || t.SampleRate <= 0:
+		return false
+	case t.SampleRate >= 1:
+		return true
+	}
+
+	return float64(uint64(trace)) < t.SampleRate*math.MaxUint64
+}
+
+// SetTracing enables tracing of the session operations, nil disables it.
+// Cloned sessions share tracing options.
+func (s *Session) SetTracing(t *TracingOptions) {
+	s.tracing = t
+}
+
+func (s *Session) GetTracing() *TracingOptions {
+	return s.tracing
+}
+
+// NewTraceID returns random non-zero trace id.
+func NewTraceID() TraceID {
+	var buf [8]byte
+	for {
+		if _, err := rand.Read(buf[:]); err != nil {
+			panic(err)
+		}
+
+		if id := binary.LittleEndian.Uint64(buf[:]); id != 0 {
+			return TraceID(id)
+		}
+	}
+}
+
+type traceIDKey struct{}
+
+// WithTraceID returns context whose requests are sent with trace id @trace.
+// Trace id passed with CallOptions takes precedence over the context one.
+func WithTraceID(ctx context.Context, trace TraceID) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, trace)
+}
+
+// TraceIDFromContext returns trace id attached to @ctx by WithTraceID, zero if there is none.
+func TraceIDFromContext(ctx context.Context) TraceID {
+	trace, _ := ctx.Value(traceIDKey{}).(TraceID)
+	return trace
+}
+
+// traceID returns trace id requests of @ctx with call options @opts are sent with.
+func (s *Session) traceID(ctx context.Context, opts *CallOptions) TraceID {
+	if opts != nil && opts.TraceID != 0 {
+		return opts.TraceID
+	}
+
+	if trace := TraceIDFromContext(ctx); trace != 0 {
+		return trace
+	}
+
+	return s.GetTraceID()
+}
+
+// traceOptions sets trace id of @ctx on @opts and adds DNET_FLAGS_TRACE_BIT to them if the trace id is sampled.
+// @opts are never modified, a copy is returned if anything has to be changed.
+func (s *Session) traceOptions(ctx context.Context, opts *CallOptions) *CallOptions {
+	if trace := TraceIDFromContext(ctx); trace != 0 && (opts == nil || opts.TraceID == 0) {
+		opts = opts.clone()
+		opts.TraceID = trace
+	}
+
+	if s.tracing == nil || s.tracing.SampleRate <= 0 {
+		return opts
+	}
+
+	if !s.tracing.sampled(s.traceID(ctx, opts)) {
+		return opts
+	}
+
+	opts = opts.clone()
+	opts.Cflags |= DNET_FLAGS_TRACE_BIT
+	return opts
+}